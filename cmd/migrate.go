@@ -1,7 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mohammadne/phone-book/internal/config"
 	"github.com/mohammadne/phone-book/internal/models"
@@ -12,38 +21,320 @@ import (
 	"go.uber.org/zap"
 )
 
-type Migrate struct{}
+type Migrate struct {
+	dir string
+}
 
 func (m Migrate) Command(trap chan os.Signal) *cobra.Command {
-	run := func(_ *cobra.Command, args []string) {
-		m.main(config.Load(true), args, trap)
+	command := &cobra.Command{
+		Use:   "migrate",
+		Short: "run migrations",
 	}
 
-	return &cobra.Command{
-		Use:       "migrate",
-		Short:     "run migrations",
-		Run:       run,
-		Args:      cobra.OnlyValidArgs,
-		ValidArgs: []string{"up", "down"},
+	command.AddCommand(
+		&cobra.Command{
+			Use:   "up [N]",
+			Short: "apply the next N pending migrations (all of them by default)",
+			Args:  cobra.MaximumNArgs(1),
+			Run: func(_ *cobra.Command, args []string) {
+				m.steps(config.Load(true), models.Up, args, 0)
+			},
+		},
+		&cobra.Command{
+			Use:   "down [N]",
+			Short: "revert the last N applied migrations (only the last one by default)",
+			Args:  cobra.MaximumNArgs(1),
+			Run: func(_ *cobra.Command, args []string) {
+				m.steps(config.Load(true), models.Down, args, 1)
+			},
+		},
+		&cobra.Command{
+			Use:   "goto <version>",
+			Short: "apply or revert migrations until the given version (0 reverts all of them)",
+			Args:  cobra.ExactArgs(1),
+			Run: func(_ *cobra.Command, args []string) {
+				m.goTo(config.Load(true), args[0])
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "print the state of every migration",
+			Args:  cobra.NoArgs,
+			Run: func(_ *cobra.Command, _ []string) {
+				m.status(config.Load(true))
+			},
+		},
+		&cobra.Command{
+			Use:   "plan (up [N] | down [N] | goto <version>)",
+			Short: "print the SQL which would run by the given migration and the rows conflicting with it, without executing it",
+			Args:  cobra.RangeArgs(1, 2),
+			Run: func(_ *cobra.Command, args []string) {
+				m.plan(config.Load(true), args)
+			},
+		},
+		&cobra.Command{
+			Use:   "verify",
+			Short: "apply up, down and up again against a throwaway schema to prove reversibility",
+			Args:  cobra.NoArgs,
+			Run: func(_ *cobra.Command, _ []string) {
+				m.verify(config.Load(true))
+			},
+		},
+	)
+
+	create := &cobra.Command{
+		Use:   "create <name>",
+		Short: "generate the next numbered pair of up and down migration files",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			m.create(config.Load(true), args[0])
+		},
 	}
+	create.Flags().StringVar(&m.dir, "dir", "internal/repository/migrations", "directory of the migration files")
+	command.AddCommand(create)
+
+	return command
 }
 
-func (m *Migrate) main(cfg *config.Config, args []string, trap chan os.Signal) {
+func (m *Migrate) repository(cfg *config.Config) (*zap.Logger, repository.Repository) {
 	logger := logger.NewZap(cfg.Logger)
 
-	if len(args) != 1 {
-		logger.Fatal("Invalid arguments given", zap.Any("args", args))
+	repository, err := repository.Open(logger, cfg.Repository, cfg.RDBMS)
+	if err != nil {
+		logger.Fatal("Error creating repository", zap.Error(err))
+	}
+
+	return logger, repository
+}
+
+func (m *Migrate) steps(cfg *config.Config, direction models.Migrate, args []string, steps int) {
+	logger, repository := m.repository(cfg)
+
+	if len(args) == 1 {
+		var err error
+		if steps, err = strconv.Atoi(args[0]); err != nil || steps <= 0 {
+			logger.Fatal("Invalid number of migrations given", zap.String("steps", args[0]))
+		}
+	}
+
+	if err := repository.Migrate(context.Background(), direction, steps); err != nil {
+		logger.Fatal("Error migrating", zap.String("direction", string(direction)), zap.Error(err))
+	}
+
+	logger.Info("Database has been migrated successfully", zap.String("direction", string(direction)))
+}
+
+func (m *Migrate) goTo(cfg *config.Config, arg string) {
+	logger, repository := m.repository(cfg)
+
+	version, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		logger.Fatal("Invalid migration version given", zap.String("version", arg))
+	}
+
+	if err := repository.MigrateTo(context.Background(), version); err != nil {
+		logger.Fatal("Error migrating", zap.Uint64("version", version), zap.Error(err))
+	}
+
+	logger.Info("Database has been migrated successfully", zap.Uint64("version", version))
+}
+
+func (m *Migrate) status(cfg *config.Config) {
+	logger, repository := m.repository(cfg)
+
+	migrations, err := repository.Migrations(context.Background())
+	if err != nil {
+		logger.Fatal("Error reading the migrations", zap.Error(err))
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, migration := range migrations {
+		appliedAt := "-"
+		if migration.AppliedAt != nil {
+			appliedAt = migration.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(writer, "%06d\t%s\t%s\t%s\n", migration.Version, migration.Name, migration.State, appliedAt)
+	}
+	writer.Flush()
+}
+
+func (m *Migrate) plan(cfg *config.Config, args []string) {
+	logger, repository := m.repository(cfg)
+	ctx := context.Background()
+
+	var steps []models.MigrationStep
+	var err error
+
+	switch direction := args[0]; {
+	case direction == "goto" && len(args) == 2:
+		version, parseErr := strconv.ParseUint(args[1], 10, 64)
+		if parseErr != nil {
+			logger.Fatal("Invalid migration version given", zap.String("version", args[1]))
+		}
+		steps, err = repository.PlanMigrateTo(ctx, version)
+	case direction == string(models.Up) || direction == string(models.Down):
+		count := 0
+		if direction == string(models.Down) {
+			count = 1
+		}
+		if len(args) == 2 {
+			if count, err = strconv.Atoi(args[1]); err != nil || count <= 0 {
+				logger.Fatal("Invalid number of migrations given", zap.String("steps", args[1]))
+			}
+		}
+		steps, err = repository.PlanMigrate(ctx, models.Migrate(direction), count)
+	default:
+		logger.Fatal("Invalid arguments given", zap.Strings("args", args))
 	}
 
-	rdbms, err := rdbms.New(cfg.RDBMS)
+	if err != nil {
+		logger.Fatal("Error planning the migrations", zap.Error(err))
+	} else if len(steps) == 0 {
+		fmt.Println("-- nothing to run, the schema is up to date")
+		return
+	}
+
+	conflicting := false
+	for _, step := range steps {
+		fmt.Printf("-- %06d_%s.%s.sql\n", step.Version, step.Name, step.Direction)
+		for _, conflict := range step.Conflicts {
+			fmt.Printf("-- CONFLICT: %s\n", conflict)
+		}
+		fmt.Println(strings.TrimSpace(step.Statement))
+		conflicting = conflicting || len(step.Conflicts) > 0
+	}
+
+	if conflicting {
+		logger.Fatal("Existing rows conflict with the planned migrations, resolve them before migrating")
+	}
+}
+
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func (m *Migrate) create(cfg *config.Config, name string) {
+	logger := logger.NewZap(cfg.Logger)
+
+	name = strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(name))
+	if !migrationName.MatchString(name) {
+		logger.Fatal("Invalid migration name, only letters, digits and underscores are allowed", zap.String("name", name))
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		logger.Fatal("Error reading migrations directory", zap.String("dir", m.dir), zap.Error(err))
+	}
+
+	var latest uint64
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		if version, err := strconv.ParseUint(prefix, 10, 64); err == nil && version > latest {
+			latest = version
+		}
+	}
+
+	for _, direction := range []models.Migrate{models.Up, models.Down} {
+		file := filepath.Join(m.dir, fmt.Sprintf("%06d_%s.%s.sql", latest+1, name, direction))
+		content := fmt.Sprintf("-- %s migration of %s\n", direction, name)
+
+		handle, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = handle.WriteString(content)
+			if closeErr := handle.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			logger.Fatal("Error creating migration file", zap.String("file", file), zap.Error(err))
+		}
+
+		logger.Info("Migration file has been created", zap.String("file", file))
+	}
+}
+
+// QuerySchemaSnapshot describes the columns and indexes of the schema, except the bookkeeping table
+const QuerySchemaSnapshot = `
+SELECT table_name || '.' || column_name || ' ' || data_type || ' ' || is_nullable || ' ' || COALESCE(column_default, '') AS object
+FROM information_schema.columns
+WHERE table_schema=$1 AND table_name <> 'schema_migrations'
+UNION ALL
+SELECT indexdef AS object
+FROM pg_indexes
+WHERE schemaname=$1 AND tablename <> 'schema_migrations'
+ORDER BY object;`
+
+func (m *Migrate) verify(cfg *config.Config) {
+	logger := logger.NewZap(cfg.Logger)
+	ctx := context.Background()
+
+	db, err := rdbms.New(cfg.RDBMS)
 	if err != nil {
 		logger.Fatal("Error creating rdbms", zap.Error(err))
 	}
 
-	repository := repository.New(logger, cfg.Repository, rdbms)
-	if err := repository.Migrate(models.Migrate(args[0])); err != nil {
-		logger.Fatal("Error migrating", zap.String("migration", args[0]), zap.Error(err))
+	schema := fmt.Sprintf("migrate_verify_%d", time.Now().UnixNano())
+	if err := db.Execute(ctx, "CREATE SCHEMA "+schema, []any{}); err != nil {
+		logger.Fatal("Error creating the throwaway schema", zap.String("schema", schema), zap.Error(err))
 	}
+	logger.Info("Throwaway schema has been created", zap.String("schema", schema))
 
-	logger.Info("Database has been migrated successfully", zap.String("migration", args[0]))
+	err = m.reversible(ctx, logger, cfg, schema)
+
+	if dropErr := db.Execute(ctx, "DROP SCHEMA "+schema+" CASCADE", []any{}); dropErr != nil {
+		logger.Error("Error dropping the throwaway schema", zap.String("schema", schema), zap.Error(dropErr))
+	}
+
+	if err != nil {
+		logger.Fatal("Migrations are not reversible", zap.Error(err))
+	}
+	logger.Info("Migrations have been verified successfully")
+}
+
+// reversible applies all the migrations up, down and up again inside of the schema,
+// reverting must leave nothing behind and re-applying must produce the very same schema.
+func (m *Migrate) reversible(ctx context.Context, logger *zap.Logger, cfg *config.Config, schema string) error {
+	scoped := *cfg.RDBMS
+	scoped.Schema = schema
+
+	db, err := rdbms.New(&scoped)
+	if err != nil {
+		return err
+	}
+	repository := repository.New(logger, cfg.Repository, db)
+
+	snapshot := func() ([]string, error) {
+		return rdbms.Collect(ctx, db, QuerySchemaSnapshot, []any{schema}, func(row rdbms.Row, object *string) error {
+			return row.Scan(object)
+		})
+	}
+
+	if err := repository.Migrate(ctx, models.Up, 0); err != nil {
+		return err
+	}
+	applied, err := snapshot()
+	if err != nil {
+		return err
+	}
+
+	if err := repository.Migrate(ctx, models.Down, 0); err != nil {
+		return err
+	}
+	if leftovers, err := snapshot(); err != nil {
+		return err
+	} else if len(leftovers) != 0 {
+		return fmt.Errorf("reverting all migrations has left objects behind:\n%s", strings.Join(leftovers, "\n"))
+	}
+
+	if err := repository.Migrate(ctx, models.Up, 0); err != nil {
+		return err
+	}
+	reapplied, err := snapshot()
+	if err != nil {
+		return err
+	}
+
+	if strings.Join(applied, "\n") != strings.Join(reapplied, "\n") {
+		return errors.New("re-applying the migrations has produced a different schema")
+	}
+	return nil
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/mohammadne/phone-book/internal/api/http"
+	"github.com/mohammadne/phone-book/internal/config"
+	"github.com/mohammadne/phone-book/pkg/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+type OpenAPI struct {
+	check bool
+}
+
+func (cmd OpenAPI) Command(trap chan os.Signal) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "openapi",
+		Short: "print the OpenAPI document generated from the routes of the client server",
+		Args:  cobra.NoArgs,
+		Run: func(_ *cobra.Command, _ []string) {
+			cmd.main(config.Load(true))
+		},
+	}
+
+	command.Flags().BoolVar(&cmd.check, "check", false, "only fail when the document and the routes diverge, like in the CI")
+	return command
+}
+
+func (cmd *OpenAPI) main(cfg *config.Config) {
+	logger := logger.NewZap(cfg.Logger)
+
+	// the document is generated from the registered routes only, so the server needs no dependency
+	server, err := http.New(cfg.HTTP, logger, nil, nil, nil)
+	if err != nil {
+		logger.Fatal("OpenAPI document doesn't match the routes", zap.Error(err))
+	}
+
+	document, err := server.OpenAPI()
+	if err != nil {
+		logger.Fatal("Error generating the OpenAPI document", zap.Error(err))
+	}
+
+	if cmd.check {
+		logger.Info("OpenAPI document matches the routes")
+		return
+	}
+
+	os.Stdout.Write(append(document, '\n'))
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/config"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/logger"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+type Organization struct {
+	name        string
+	maxUsers    int
+	maxContacts int
+}
+
+func (o Organization) Command(trap chan os.Signal) *cobra.Command {
+	command := &cobra.Command{
+		Use:   "organization",
+		Short: "manage the organizations (tenants)",
+	}
+
+	create := &cobra.Command{
+		Use:   "create <slug> <name>",
+		Short: "create an organization, its slug is the subdomain of its users",
+		Args:  cobra.ExactArgs(2),
+		Run: func(command *cobra.Command, args []string) {
+			o.create(config.Load(true), command, args[0], args[1])
+		},
+	}
+
+	update := &cobra.Command{
+		Use:   "update <slug>",
+		Short: "change the name or the limits of an organization",
+		Args:  cobra.ExactArgs(1),
+		Run: func(command *cobra.Command, args []string) {
+			o.update(config.Load(true), command, args[0])
+		},
+	}
+	update.Flags().StringVar(&o.name, "name", "", "name of the organization")
+
+	// a negative limit removes it, so the organization becomes unlimited
+	for _, c := range []*cobra.Command{create, update} {
+		c.Flags().IntVar(&o.maxUsers, "max-users", -1, "maximum number of users (negative for unlimited)")
+		c.Flags().IntVar(&o.maxContacts, "max-contacts", -1, "maximum number of contacts (negative for unlimited)")
+	}
+
+	command.AddCommand(create, update, &cobra.Command{
+		Use:   "list",
+		Short: "print the organizations along with their usage",
+		Args:  cobra.NoArgs,
+		Run: func(_ *cobra.Command, _ []string) {
+			o.list(config.Load(true))
+		},
+	})
+
+	return command
+}
+
+func (o *Organization) repository(cfg *config.Config) (*zap.Logger, repository.Repository) {
+	logger := logger.NewZap(cfg.Logger)
+
+	repository, err := repository.Open(logger, cfg.Repository, cfg.RDBMS)
+	if err != nil {
+		logger.Fatal("Error creating repository", zap.Error(err))
+	}
+
+	return logger, repository
+}
+
+func (o *Organization) create(cfg *config.Config, command *cobra.Command, slug, name string) {
+	logger, repository := o.repository(cfg)
+
+	org := &models.Organization{Slug: slug, Name: name}
+	o.limits(command, org)
+	if !org.IsValid() {
+		logger.Fatal("Invalid organization given", zap.Any("organization", org))
+	}
+
+	if err := repository.CreateOrganization(context.Background(), org); err != nil {
+		logger.Fatal("Error creating the organization", zap.String("slug", slug), zap.Error(err))
+	}
+
+	logger.Info("Organization has been created", zap.Uint64("id", org.Id), zap.String("slug", slug))
+}
+
+func (o *Organization) update(cfg *config.Config, command *cobra.Command, slug string) {
+	logger, repository := o.repository(cfg)
+	ctx := context.Background()
+
+	org, err := repository.GetOrganizationBySlug(ctx, slug)
+	if err != nil {
+		logger.Fatal("Error getting the organization", zap.String("slug", slug), zap.Error(err))
+	}
+
+	if command.Flags().Changed("name") {
+		org.Name = o.name
+	}
+	o.limits(command, org)
+	if !org.IsValid() {
+		logger.Fatal("Invalid organization given", zap.Any("organization", org))
+	}
+
+	if err := repository.UpdateOrganization(ctx, org); err != nil {
+		logger.Fatal("Error updating the organization", zap.String("slug", slug), zap.Error(err))
+	}
+
+	logger.Info("Organization has been updated", zap.String("slug", slug))
+}
+
+// limits sets the limits given by the flags, leaving the others untouched
+func (o *Organization) limits(command *cobra.Command, org *models.Organization) {
+	limit := func(value int) *int {
+		if value < 0 {
+			return nil
+		}
+		return &value
+	}
+
+	if command.Flags().Changed("max-users") {
+		org.MaxUsers = limit(o.maxUsers)
+	}
+	if command.Flags().Changed("max-contacts") {
+		org.MaxContacts = limit(o.maxContacts)
+	}
+}
+
+func (o *Organization) list(cfg *config.Config) {
+	logger, repository := o.repository(cfg)
+
+	orgs, err := repository.GetOrganizations(context.Background())
+	if err != nil {
+		logger.Fatal("Error reading the organizations", zap.Error(err))
+	}
+
+	limit := func(count int, max *int) string {
+		if max == nil {
+			return strconv.Itoa(count)
+		}
+		return fmt.Sprintf("%d/%d", count, *max)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSLUG\tNAME\tUSERS\tCONTACTS\tCREATED AT")
+	for _, org := range orgs {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\n", org.Id, org.Slug, org.Name,
+			limit(org.UsersCount, org.MaxUsers), limit(org.ContactsCount, org.MaxContacts),
+			org.CreatedAt.Format(time.RFC3339))
+	}
+	writer.Flush()
+}
@@ -1,50 +1,81 @@
 package cmd
 
 import (
+	"context"
 	"os"
 
 	"github.com/mohammadne/phone-book/internal/api/http"
 	"github.com/mohammadne/phone-book/internal/config"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/purger"
 	"github.com/mohammadne/phone-book/internal/repository"
 	"github.com/mohammadne/phone-book/pkg/logger"
-	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/storage"
 	"github.com/mohammadne/phone-book/pkg/token"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
-type Server struct{}
+type Server struct {
+	migrate bool
+}
 
 func (cmd Server) Command(trap chan os.Signal) *cobra.Command {
 	run := func(_ *cobra.Command, _ []string) {
 		cmd.main(config.Load(true), trap)
 	}
 
-	return &cobra.Command{
+	command := &cobra.Command{
 		Use:   "server",
 		Short: "run PhoneBook server",
 		Run:   run,
 	}
+
+	command.Flags().BoolVar(&cmd.migrate, "migrate", false, "apply the pending migrations before serving")
+	return command
 }
 
 func (cmd *Server) main(cfg *config.Config, trap chan os.Signal) {
 	logger := logger.NewZap(cfg.Logger)
 
-	rdbms, err := rdbms.New(cfg.RDBMS)
+	repo, err := repository.Open(logger, cfg.Repository, cfg.RDBMS)
 	if err != nil {
-		logger.Panic("Error creating rdbms database", zap.Error(err))
+		logger.Panic("Error creating repository", zap.Error(err))
 	}
 
-	repo := repository.New(logger, cfg.Repository, rdbms)
+	if cmd.migrate {
+		if err := repo.Migrate(context.Background(), models.Up, 0); err != nil {
+			logger.Panic("Error applying the pending migrations", zap.Error(err))
+		}
+	}
 
 	token, err := token.New(cfg.Token)
 	if err != nil {
 		logger.Panic("Error creating token object", zap.Error(err))
 	}
 
-	http.New(logger, repo, token).Serve()
+	storage, err := storage.New(cfg.Storage)
+	if err != nil {
+		logger.Panic("Error creating storage", zap.Error(err))
+	}
+
+	purger, err := purger.New(cfg.Purger, logger, repo, storage)
+	if err != nil {
+		logger.Panic("Error creating purger", zap.Error(err))
+	}
+	purger.Start()
+
+	server, err := http.New(cfg.HTTP, logger, repo, token, storage)
+	if err != nil {
+		logger.Panic("Error creating http server", zap.Error(err))
+	}
+	server.Serve()
 
 	// Keep this at the bottom of the main function
 	field := zap.String("signal trap", (<-trap).String())
 	logger.Info("exiting by receiving a unix signal", field)
+
+	if err := repo.Close(); err != nil {
+		logger.Error("Error closing repository", zap.Error(err))
+	}
 }
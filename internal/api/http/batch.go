@@ -0,0 +1,117 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/validate"
+	"go.uber.org/zap"
+)
+
+type batchRequest struct {
+	Atomic     bool                    `json:"atomic"`
+	Operations []models.BatchOperation `json:"operations"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	models.BatchResult
+	Status int             `json:"status"`
+	Code   Code            `json:"code,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Errors validate.Errors `json:"errors,omitempty"` // the invalid fields of a failed validation
+}
+
+func (handler *Server) batchContacts(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	request := batchRequest{}
+	if err := c.BodyParser(&request); err != nil {
+		errString := "Error parsing request body"
+		handler.logger.Error(errString, zap.Error(err))
+		return problem(CodeInvalidBody, errString)
+	}
+
+	if len(request.Operations) == 0 || len(request.Operations) > handler.config.BatchMaxSize {
+		return problem(CodeInvalidBatch, fmt.Sprintf("A batch must have between 1 and %d operations", handler.config.BatchMaxSize))
+	}
+
+	results, err := handler.repository.BatchContacts(c.UserContext(), userId, request.Operations, request.Atomic)
+	if err != nil && !request.Atomic {
+		errString := "Error happened while running the batch"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Error(err))
+		return failure(err)
+	}
+
+	response := make([]batchResult, len(results))
+	for index, result := range results {
+		response[index] = batchResult{BatchResult: result, Status: batchStatus(result)}
+		if result.Err == nil {
+			continue
+		}
+
+		// the errors may carry the details of the database, so only their title is responded
+		code := batchCode(result.Err)
+		response[index].Code, response[index].Error = code, codes[code].title
+		errors.As(result.Err, &response[index].Errors)
+		if code == CodeInternal || code == CodeConflict {
+			handler.logger.Error("Error happened while running a batch operation", zap.Uint64("user-id", userId), zap.Int("index", index), zap.Error(result.Err))
+		}
+	}
+
+	// atomic batches fail as a whole, the results tell which operation caused it
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusConflict
+	}
+
+	return c.Status(status).JSON(&batchResponse{Results: response})
+}
+
+func batchStatus(result models.BatchResult) int {
+	switch {
+	case result.Err == nil && result.Op == models.BatchCreate:
+		return http.StatusCreated
+	case result.Err == nil:
+		return http.StatusOK
+	default:
+		return codes[batchCode(result.Err)].status
+	}
+}
+
+// batchCode returns the code of a failed operation, the same one as its standalone request would have
+func batchCode(err error) Code {
+	var errs validate.Errors
+	switch {
+	case errors.As(err, &errs):
+		return CodeValidation
+	case errors.Is(err, repository.ErrInvalidOperation):
+		return CodeInvalidOperation
+	case errors.Is(err, repository.ErrContactsLimitExceeded):
+		return CodeContactsLimit
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return CodeVersionMismatch
+	case errors.Is(err, repository.ErrBatchAborted):
+		return CodeBatchAborted
+	case errors.Is(err, rdbms.ErrNotFound):
+		return CodeContactNotFound
+	case errors.Is(err, rdbms.ErrDuplicate), errors.Is(err, rdbms.ErrSerialization), errors.Is(err, rdbms.ErrDeadlock):
+		return CodeConflict
+	case errors.Is(err, rdbms.ErrForeignKey), errors.Is(err, rdbms.ErrCheck), errors.Is(err, rdbms.ErrNotNull):
+		return CodeInvalidContact
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,18 @@
+package http
+
+import "time"
+
+type Config struct {
+	BodyMaxSize    int           `koanf:"body_max_size"` // of every request but the photo uploads
+	PhotoMaxSize   int           `koanf:"photo_max_size"`
+	BatchMaxSize   int           `koanf:"batch_max_size"`
+	RequestTimeout time.Duration `koanf:"request_timeout"`
+
+	// Domain is the base domain of the organizations subdomains (like acme.<domain>), the
+	// requests without any subdomain belong to the default organization.
+	Domain              string `koanf:"domain"`
+	DefaultOrganization string `koanf:"default_organization"`
+
+	// ClientURL is the public address of the client app, the server of the OpenAPI document
+	ClientURL string `koanf:"client_url"`
+}
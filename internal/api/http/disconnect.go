@@ -0,0 +1,48 @@
+//go:build unix
+
+package http
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect cancels the context once the client closes the connection, which is told by
+// peeking the socket so no byte of a pipelined request is consumed. The returned function stops
+// watching, it must be called before the server reads the connection again.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {} // like the TLS connections, which only have their deadline
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		buffer := make([]byte, 1)
+		raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buffer, syscall.MSG_PEEK)
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				return false // wait until the socket is readable
+			} else if n == 0 {
+				cancel() // closed or reset by the client
+			}
+			return true
+		})
+	}()
+
+	return func() {
+		// a past deadline wakes up the watcher, then it's cleared as the server sets its own deadlines
+		conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package http
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect doesn't watch the connections of the other platforms, their requests are only
+// canceled by the request timeout.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/pkg/validate"
+	"go.uber.org/zap"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Code identifies the kind of an error, unlike the details the codes are stable so the clients can rely on them
+type Code string
+
+const (
+	CodeInvalidBody          Code = "invalid_body"
+	CodeInvalidParameter     Code = "invalid_parameter"
+	CodeInvalidCursor        Code = "invalid_cursor"
+	CodeInvalidContact       Code = "invalid_contact"
+	CodeValidation           Code = "validation_failed"
+	CodeInvalidPatch         Code = "invalid_patch"
+	CodeInvalidPhoto         Code = "invalid_photo"
+	CodeInvalidOperation     Code = "invalid_operation"
+	CodeInvalidBatch         Code = "invalid_batch"
+	CodeUnauthenticated      Code = "unauthenticated"
+	CodeInvalidToken         Code = "invalid_token"
+	CodeWrongCredentials     Code = "wrong_credentials"
+	CodeWrongOrganization    Code = "wrong_organization"
+	CodeUsersLimit           Code = "users_limit_exceeded"
+	CodeContactsLimit        Code = "contacts_limit_exceeded"
+	CodeTagsLimit            Code = "tags_limit_exceeded"
+	CodeRouteNotFound        Code = "route_not_found"
+	CodeOrganizationNotFound Code = "organization_not_found"
+	CodeContactNotFound      Code = "contact_not_found"
+	CodeRevisionNotFound     Code = "revision_not_found"
+	CodeTagNotFound          Code = "tag_not_found"
+	CodePhotoNotFound        Code = "photo_not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeEmailTaken           Code = "email_taken"
+	CodeTagExists            Code = "tag_exists"
+	CodeConflict             Code = "conflict"
+	CodePatchTestFailed      Code = "patch_test_failed"
+	CodePatchNotApplicable   Code = "patch_not_applicable"
+	CodeVersionMismatch      Code = "version_mismatch"
+	CodeBatchAborted         Code = "batch_aborted"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeUnsupportedMedia     Code = "unsupported_media_type"
+	CodeInternal             Code = "internal"
+	CodeTimeout              Code = "timeout"
+)
+
+// codes is the catalog of the errors, every code is always responded with the same status
+var codes = map[Code]struct {
+	status int
+	title  string
+}{
+	CodeInvalidBody:          {http.StatusBadRequest, "The request body can't be parsed"},
+	CodeInvalidParameter:     {http.StatusBadRequest, "A parameter of the request is invalid"},
+	CodeInvalidCursor:        {http.StatusBadRequest, "The pagination cursor is invalid or expired"},
+	CodeInvalidContact:       {http.StatusUnprocessableEntity, "The contact is invalid"},
+	CodeValidation:           {http.StatusUnprocessableEntity, "Some fields of the request are invalid"},
+	CodeInvalidPatch:         {http.StatusBadRequest, "The patch document is invalid"},
+	CodeInvalidPhoto:         {http.StatusUnprocessableEntity, "The photo can't be processed"},
+	CodeInvalidOperation:     {http.StatusUnprocessableEntity, "The batch operation is invalid"},
+	CodeInvalidBatch:         {http.StatusBadRequest, "The batch is invalid"},
+	CodeUnauthenticated:      {http.StatusUnauthorized, "Authentication is required"},
+	CodeInvalidToken:         {http.StatusUnauthorized, "The token is invalid or expired"},
+	CodeWrongCredentials:     {http.StatusUnauthorized, "The email or the password is wrong"},
+	CodeWrongOrganization:    {http.StatusForbidden, "The token belongs to another organization"},
+	CodeUsersLimit:           {http.StatusForbidden, "The organization has reached its users limit"},
+	CodeContactsLimit:        {http.StatusForbidden, "The organization has reached its contacts limit"},
+	CodeTagsLimit:            {http.StatusForbidden, "The user has reached the tags limit"},
+	CodeRouteNotFound:        {http.StatusNotFound, "The route doesn't exist"},
+	CodeOrganizationNotFound: {http.StatusNotFound, "The organization doesn't exist"},
+	CodeContactNotFound:      {http.StatusNotFound, "The contact doesn't exist"},
+	CodeRevisionNotFound:     {http.StatusNotFound, "The revision doesn't exist"},
+	CodeTagNotFound:          {http.StatusNotFound, "The tag doesn't exist"},
+	CodePhotoNotFound:        {http.StatusNotFound, "The contact doesn't have any photo"},
+	CodeMethodNotAllowed:     {http.StatusMethodNotAllowed, "The method isn't allowed on the route"},
+	CodeEmailTaken:           {http.StatusConflict, "A user with the email already exists"},
+	CodeTagExists:            {http.StatusConflict, "A tag with the name already exists"},
+	CodeConflict:             {http.StatusConflict, "The request conflicts with a concurrent one"},
+	CodePatchTestFailed:      {http.StatusConflict, "A test operation of the patch has failed"},
+	CodePatchNotApplicable:   {http.StatusUnprocessableEntity, "The patch can't be applied to the contact"},
+	CodeVersionMismatch:      {http.StatusPreconditionFailed, "The contact has been modified since it was fetched"},
+	CodeBatchAborted:         {http.StatusFailedDependency, "The batch has been aborted by another operation"},
+	CodePayloadTooLarge:      {http.StatusRequestEntityTooLarge, "The request body is too large"},
+	CodeUnsupportedMedia:     {http.StatusUnsupportedMediaType, "The content type isn't supported"},
+	CodeInternal:             {http.StatusInternalServerError, "An unexpected error has happened"},
+	CodeTimeout:              {http.StatusServiceUnavailable, "The request has timed out"},
+}
+
+// Problem is an RFC 7807 problem details object, the body of every error response. The type is
+// a URN of the code, so it identifies the kind of the problem without pointing to any document.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     Code   `json:"code"`
+
+	Errors validate.Errors `json:"errors,omitempty"` // the invalid fields of a failed validation
+}
+
+func (p *Problem) Error() string {
+	if len(p.Detail) != 0 {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// problem returns the error of the code, it's sent by the error handler once returned from a handler
+func problem(code Code, detail string) error {
+	return newProblem(code, detail)
+}
+
+func newProblem(code Code, detail string) *Problem {
+	entry, ok := codes[code]
+	if !ok {
+		code, entry = CodeInternal, codes[CodeInternal]
+	}
+
+	return &Problem{Type: "urn:phone-book:problem:" + string(code), Title: entry.title, Status: entry.status, Detail: detail, Code: code}
+}
+
+// invalid returns the problem of a failed validation, which lists every invalid field
+func invalid(err error) error {
+	var errs validate.Errors
+	if !errors.As(err, &errs) {
+		return failure(err)
+	}
+
+	p := newProblem(CodeValidation, errs.Error())
+	p.Errors = errs
+	return p
+}
+
+// failure is the problem of an unexpected error, whose details aren't exposed to the clients
+func failure(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return problem(CodeTimeout, "")
+	}
+	return problem(CodeInternal, "")
+}
+
+// fiberCodes maps the errors of the framework itself, like the unknown routes
+var fiberCodes = map[int]Code{
+	http.StatusBadRequest:            CodeInvalidBody,
+	http.StatusNotFound:              CodeRouteNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusRequestTimeout:        CodeTimeout,
+}
+
+// errorHandler responds every error returned by the handlers as a problem
+func (s *Server) errorHandler(c *fiber.Ctx, err error) error {
+	var p *Problem
+	var fiberErr *fiber.Error
+	if errors.As(err, &p) {
+		// the problems are already logged where they're raised
+	} else if errors.As(err, &fiberErr) {
+		code, ok := fiberCodes[fiberErr.Code]
+		if !ok {
+			code = CodeInternal
+		}
+		p = newProblem(code, fiberErr.Message)
+	} else {
+		s.logger.Error("Unexpected error returned by handler", zap.String("path", c.Path()), zap.Error(err))
+		errors.As(failure(err), &p)
+	}
+
+	response := *p
+	response.Instance = c.OriginalURL()
+
+	body, err := json.Marshal(&response)
+	if err != nil {
+		return c.SendStatus(http.StatusInternalServerError)
+	}
+
+	if response.Status == http.StatusUnauthorized {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="phone-book"`)
+	}
+	c.Set(fiber.HeaderContentType, MIMEProblemJSON)
+	return c.Status(response.Status).Send(body)
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+)
+
+// contactETag tags the representation of the contact, which is the version of its content along
+// with the favorite and the usage statistics since they change without bumping the version.
+func contactETag(contact *models.Contact) string {
+	favorite := 0
+	if contact.Favorite {
+		favorite = 1
+	}
+	return fmt.Sprintf(`"%d.%d.%d"`, contact.Version, contact.UsageCount, favorite)
+}
+
+// versionOf returns the version of the content tagged by an etag of contactETag
+func versionOf(etag string) (uint64, bool) {
+	version, _, _ := strings.Cut(strings.Trim(etag, `"`), ".")
+	parsed, err := strconv.ParseUint(version, 10, 64)
+	return parsed, err == nil
+}
+
+// matchETag checks the etag against a list of entity tags of a conditional header,
+// weak comparison ignores the W/ prefix while in strong comparison weak tags never match.
+func matchETag(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch evaluates the If-Match precondition against the current state of the contact,
+// the returned version is the one which the change must be conditioned on (zero if there's no precondition).
+// Only the versions of the tags are compared, so favoriting or using the contact meanwhile doesn't fail the edits.
+func checkIfMatch(c *fiber.Ctx, current *models.Contact) (uint64, bool) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if len(header) == 0 {
+		return 0, true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return current.Version, true
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue // weak tags never match strongly
+		}
+
+		if version, ok := versionOf(candidate); ok && version == current.Version {
+			return current.Version, true
+		}
+	}
+	return 0, false
+}
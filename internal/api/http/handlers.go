@@ -1,13 +1,16 @@
 package http
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
 	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/validate"
 	"go.uber.org/zap"
 )
 
@@ -19,130 +22,176 @@ func (handler *Server) readiness(c *fiber.Ctx) error {
 	return c.SendStatus(http.StatusOK)
 }
 
+type tokenResponse struct {
+	Token string `json:"Token"`
+}
+
+// registration is the body of register, the limits match the columns of the users table
+type registration struct {
+	Email    string `json:"email" validate:"required,max=50,email"`
+	Password string `json:"password" validate:"required,min=8,max=50,password"`
+}
+
+// credentials is the body of login, the password policy isn't checked
+// so the users registered before it can still login.
+type credentials struct {
+	Email    string `json:"email" validate:"required,max=50"`
+	Password string `json:"password" validate:"required,max=50"`
+}
+
 func (handler *Server) register(c *fiber.Ctx) error {
-	request := struct{ Email, Password string }{}
+	request := registration{}
 	if err := c.BodyParser(&request); err != nil {
 		errString := "Error parsing request body"
 		handler.logger.Error(errString, zap.Any("request", request), zap.Error(err))
-		return c.Status(http.StatusBadRequest).SendString(errString)
+		return problem(CodeInvalidBody, errString)
+	} else if err := validate.Struct(&request); err != nil {
+		handler.logger.Error("Error invalid registration has been given", zap.String("email", request.Email), zap.Error(err))
+		return invalid(err)
 	}
 
-	user, err := handler.repository.GetUserByEmail(request.Email)
-	if err != nil && err.Error() != rdbms.ErrNotFound {
-		errString := "Error while retrieving data from database"
-		handler.logger.Error(errString, zap.Error(err))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
-	} else if err == nil || (user != nil && user.Id != 0) {
-		errString := "User with given email already exists"
-		handler.logger.Error(errString, zap.String("email", request.Email))
-		return c.Status(http.StatusBadRequest).SendString(errString)
-	}
+	// emails are unique in the database, so concurrent registrations can't both succeed
+	user := &models.User{Email: request.Email, Password: request.Password}
+	if err := handler.repository.CreateUser(c.UserContext(), user); err != nil {
+		if errors.Is(err, rdbms.ErrDuplicate) {
+			errString := "User with given email already exists"
+			handler.logger.Error(errString, zap.String("email", request.Email))
+			return problem(CodeEmailTaken, errString)
+		} else if errors.Is(err, repository.ErrUsersLimitExceeded) {
+			return problem(CodeUsersLimit, err.Error())
+		}
 
-	user = &models.User{Email: request.Email, Password: request.Password}
-	if err := handler.repository.CreateUser(user); err != nil {
 		errString := "Error happened while creating the user"
 		handler.logger.Error(errString, zap.Error(err))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
+		return failure(err)
 	} else if user.Id == 0 {
 		errString := "Error invalid user id created"
 		handler.logger.Error(errString, zap.Any("user", user))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
+		return problem(CodeInternal, "")
 	}
 
-	token, err := handler.token.CreateTokenString(user.Id)
+	token, err := handler.createToken(c, user)
 	if err != nil {
 		errString := "Error creating JWT token for user"
 		handler.logger.Error(errString, zap.Any("user", user), zap.Error(err))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
+		return failure(err)
 	}
 
-	response := map[string]string{"Token": token}
+	response := tokenResponse{Token: token}
 	return c.Status(http.StatusCreated).JSON(&response)
 }
 
+// createToken creates a token for the user of the organization resolved for the request
+func (handler *Server) createToken(c *fiber.Ctx, user *models.User) (string, error) {
+	org, ok := c.Locals("organization").(*models.Organization)
+	if !ok || org.Id != user.OrganizationId {
+		return "", fmt.Errorf("Error user doesn't belong to the organization of the request")
+	}
+
+	claims := &models.Claims{UserId: user.Id, OrganizationId: org.Id, Organization: org.Slug}
+	return handler.token.CreateTokenString(c.UserContext(), claims)
+}
+
 func (handler *Server) login(c *fiber.Ctx) error {
-	request := struct{ Email, Password string }{}
+	request := credentials{}
 	if err := c.BodyParser(&request); err != nil {
 		errString := "Error parsing request body"
 		handler.logger.Error(errString, zap.Error(err))
-		return c.Status(http.StatusBadRequest).SendString(errString)
+		return problem(CodeInvalidBody, errString)
+	} else if err := validate.Struct(&request); err != nil {
+		handler.logger.Error("Error invalid credentials have been given", zap.String("email", request.Email), zap.Error(err))
+		return invalid(err)
 	}
 
-	user, err := handler.repository.GetUserByEmailAndPassword(request.Email, request.Password)
-	if err != nil {
+	user, err := handler.repository.GetUserByEmailAndPassword(c.UserContext(), request.Email, request.Password)
+	if errors.Is(err, rdbms.ErrNotFound) {
 		errString := "Wrong email or password has been given"
 		handler.logger.Error(errString, zap.Error(err))
-		return c.Status(http.StatusBadRequest).SendString(errString)
+		return problem(CodeWrongCredentials, errString)
+	} else if err != nil {
+		errString := "Error happened while getting the user"
+		handler.logger.Error(errString, zap.Error(err))
+		return failure(err)
 	} else if user == nil {
 		errString := "Error invalid user returned"
 		handler.logger.Error(errString, zap.Any("request", request))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
+		return problem(CodeInternal, "")
 	}
 
-	token, err := handler.token.CreateTokenString(user.Id)
+	token, err := handler.createToken(c, user)
 	if err != nil {
 		errString := "Error creating JWT token for user"
 		handler.logger.Error(errString, zap.Any("user", user), zap.Error(err))
-		return c.Status(http.StatusInternalServerError).SendString(errString)
+		return failure(err)
 	}
 
-	response := map[string]string{"Token": token}
+	response := tokenResponse{Token: token}
 	return c.Status(http.StatusOK).JSON(&response)
 }
 
-func (handler *Server) getContacts(c *fiber.Ctx) error {
-	userId, ok := c.Locals("user-id").(uint64)
-	if !ok || userId == 0 {
-		handler.logger.Error("Invalid user-id local")
-		return c.SendStatus(http.StatusInternalServerError)
-	}
+// getContacts returns a paginated handler of the given listing of contacts
+func (handler *Server) getContacts(listing models.Listing) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userId, ok := c.Locals("user-id").(uint64)
+		if !ok || userId == 0 {
+			handler.logger.Error("Invalid user-id local")
+			return problem(CodeInternal, "")
+		}
 
-	limit, _ := strconv.Atoi(c.Query("limit"))
-	var cursor string = c.Query("cursor")
-	var search string = c.Query("search")
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		query := &models.ContactsQuery{
+			Listing: listing,
+			Cursor:  c.Query("cursor"),
+			Search:  c.Query("search"),
+			Tag:     c.Query("tag"),
+			Limit:   limit,
+			Total:   c.QueryBool("total"),
+		}
 
-	contacts, newCursor, err := handler.repository.GetContacts(userId, cursor, search, limit)
-	if err != nil {
-		errString := "Error happened while getting contacts"
-		handler.logger.Error(errString, zap.ByteString("query", c.Request().URI().FullURI()), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
-	} else if len(contacts) == 0 {
-		errString := "Not found any contact"
-		handler.logger.Error(errString, zap.String("cursor", cursor))
-		return c.SendStatus(http.StatusNotFound)
-	}
+		page, err := handler.repository.GetContacts(c.UserContext(), userId, query)
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			handler.logger.Error("Invalid cursor has been given", zap.String("cursor", query.Cursor), zap.Error(err))
+			return problem(CodeInvalidCursor, err.Error())
+		} else if err != nil {
+			errString := "Error happened while getting contacts"
+			handler.logger.Error(errString, zap.ByteString("query", c.Request().URI().FullURI()), zap.Error(err))
+			return failure(err)
+		}
 
-	return c.Status(http.StatusCreated).JSON(&map[string]any{
-		"cursor":   newCursor,
-		"contacts": contacts,
-	})
+		// an empty listing is still a listing, so it's not a missing resource
+		setPaginationLinks(c, page.Next, page.Prev)
+		return c.Status(http.StatusOK).JSON(page)
+	}
 }
 
 func (handler *Server) createContact(c *fiber.Ctx) error {
 	userId, ok := c.Locals("user-id").(uint64)
 	if !ok || userId == 0 {
 		handler.logger.Error("Invalid user-id local")
-		return c.SendStatus(http.StatusInternalServerError)
+		return problem(CodeInternal, "")
 	}
 
 	contact := &models.Contact{}
 	if err := c.BodyParser(contact); err != nil {
 		errString := "Error parsing request body"
 		handler.logger.Error(errString, zap.Any("contact", contact), zap.Error(err))
-		return c.Status(http.StatusBadRequest).SendString(errString)
+		return problem(CodeInvalidBody, errString)
 	}
 	contact.Id = 0
 
-	if !contact.IsValid() {
-		errString := "Error invalid contact has been given"
-		handler.logger.Error(errString, zap.Any("contact", contact))
-		return c.SendStatus(http.StatusBadRequest)
+	if err := contact.Validate(); err != nil {
+		handler.logger.Error("Error invalid contact has been given", zap.Any("contact", contact), zap.Error(err))
+		return invalid(err)
 	}
 
-	if err := handler.repository.CreateContact(userId, contact); err != nil {
+	if err := handler.repository.CreateContact(c.UserContext(), userId, contact); err != nil {
+		if errors.Is(err, repository.ErrContactsLimitExceeded) {
+			return problem(CodeContactsLimit, err.Error())
+		}
+
 		errString := "Error happened while creating the contact"
 		handler.logger.Error(errString, zap.Any("contact", contact), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
+		return failure(err)
 	}
 
 	response := "Contact has been created successfully"
@@ -153,26 +202,31 @@ func (handler *Server) getContact(c *fiber.Ctx) error {
 	userId, ok := c.Locals("user-id").(uint64)
 	if !ok || userId == 0 {
 		handler.logger.Error("Invalid user-id local")
-		return c.SendStatus(http.StatusInternalServerError)
+		return problem(CodeInternal, "")
 	}
 
 	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
 	if err != nil || contactId == 0 {
 		handler.logger.Error("Invalid token header", zap.Error(err))
-		response := "Invalid contact id in path parameters"
-		return c.Status(http.StatusBadRequest).SendString(response)
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
 	}
 
-	contact, err := handler.repository.GetContactById(userId, contactId)
+	contact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
 	if err != nil {
-		if err.Error() == rdbms.ErrNotFound {
-			response := fmt.Sprintf("The given contact id (%d) doesn't exists", contactId)
-			return c.Status(http.StatusBadRequest).SendString(response)
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
 		}
 
 		errString := "Error happened while getting the contact"
 		handler.logger.Error(errString, zap.Any("contact", contact), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
+		return failure(err)
+	}
+
+	etag := contactETag(contact)
+	c.Set(fiber.HeaderETag, etag)
+
+	if header := c.Get(fiber.HeaderIfNoneMatch); len(header) != 0 && matchETag(header, etag, true) {
+		return c.SendStatus(http.StatusNotModified)
 	}
 
 	return c.Status(http.StatusOK).JSON(contact)
@@ -182,42 +236,55 @@ func (handler *Server) updateContact(c *fiber.Ctx) error {
 	userId, ok := c.Locals("user-id").(uint64)
 	if !ok || userId == 0 {
 		handler.logger.Error("Invalid user-id local")
-		return c.SendStatus(http.StatusInternalServerError)
+		return problem(CodeInternal, "")
 	}
 
 	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
 	if err != nil || contactId == 0 {
 		handler.logger.Error("Invalid token header", zap.Error(err))
-		response := "Invalid contact id in path parameters"
-		return c.Status(http.StatusBadRequest).SendString(response)
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
 	}
 
-	oldContact, err := handler.repository.GetContactById(userId, contactId)
+	oldContact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
 	if err != nil {
-		if err.Error() == rdbms.ErrNotFound {
-			response := fmt.Sprintf("The given contact id (%d) doesn't exists", contactId)
-			return c.Status(http.StatusBadRequest).SendString(response)
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
 		}
 
 		errString := "Error happened while getting the contact"
 		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
+		return failure(err)
+	}
+
+	version, ok := checkIfMatch(c, oldContact)
+	if !ok {
+		return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
 	}
 
 	newContact := &models.Contact{}
 	if err := c.BodyParser(newContact); err != nil {
 		errString := "Error parsing request body"
 		handler.logger.Error(errString, zap.Any("contact", newContact), zap.Error(err))
-		return c.Status(http.StatusBadRequest).SendString(errString)
+		return problem(CodeInvalidBody, errString)
 	}
 	newContact.Update(oldContact)
 
-	if err := handler.repository.UpdateContact(userId, newContact); err != nil {
+	if err := newContact.Validate(); err != nil {
+		handler.logger.Error("Error invalid contact has been given", zap.Any("contact", newContact), zap.Error(err))
+		return invalid(err)
+	}
+
+	if err := handler.repository.UpdateContact(c.UserContext(), userId, newContact, version); err != nil {
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
+		}
+
 		errString := "Error happened while creating the contact"
 		handler.logger.Error(errString, zap.Any("contact", newContact), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
+		return failure(err)
 	}
 
+	c.Set(fiber.HeaderETag, contactETag(newContact))
 	response := "Contact has been updated successfully"
 	return c.Status(http.StatusOK).SendString(response)
 }
@@ -226,27 +293,127 @@ func (handler *Server) deleteContact(c *fiber.Ctx) error {
 	userId, ok := c.Locals("user-id").(uint64)
 	if !ok || userId == 0 {
 		handler.logger.Error("Invalid user-id local")
-		return c.SendStatus(http.StatusInternalServerError)
+		return problem(CodeInternal, "")
 	}
 
 	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
 	if err != nil || contactId == 0 {
 		handler.logger.Error("Invalid token header", zap.Error(err))
-		response := "Invalid contact id in path parameters"
-		return c.Status(http.StatusBadRequest).SendString(response)
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
 	}
 
-	if err := handler.repository.DeleteContact(userId, contactId); err != nil {
-		if err.Error() == rdbms.ErrNotFound {
-			response := fmt.Sprintf("The given contact id (%d) doesn't exists", contactId)
-			return c.Status(http.StatusBadRequest).SendString(response)
+	var version uint64
+	if len(c.Get(fiber.HeaderIfMatch)) != 0 {
+		contact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
+		if err != nil {
+			if errors.Is(err, rdbms.ErrNotFound) {
+				return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+			}
+
+			errString := "Error happened while getting the contact"
+			handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+			return failure(err)
+		}
+
+		if version, ok = checkIfMatch(c, contact); !ok {
+			return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
+		}
+	}
+
+	if err := handler.repository.DeleteContact(c.UserContext(), userId, contactId, version); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+		} else if errors.Is(err, repository.ErrVersionMismatch) {
+			return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
 		}
 
 		errString := "Error happened while deleting the contact"
 		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
-		return c.SendStatus(http.StatusInternalServerError)
+		return failure(err)
 	}
 
 	response := "Contact has been deleted successfully"
 	return c.Status(http.StatusOK).SendString(response)
 }
+
+func (handler *Server) restoreContact(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	if err := handler.repository.RestoreContact(c.UserContext(), userId, contactId); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists in the trash", contactId))
+		}
+
+		errString := "Error happened while restoring the contact"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return failure(err)
+	}
+
+	response := "Contact has been restored successfully"
+	return c.Status(http.StatusOK).SendString(response)
+}
+
+func (handler *Server) favoriteContact(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	// PUT marks the contact as favorite and DELETE unmarks it
+	favorite := c.Method() == fiber.MethodPut
+
+	if err := handler.repository.SetContactFavorite(c.UserContext(), userId, contactId, favorite); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+		}
+
+		errString := "Error happened while changing favorite of the contact"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (handler *Server) useContact(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	if err := handler.repository.UseContact(c.UserContext(), userId, contactId); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+		}
+
+		errString := "Error happened while marking the contact as used"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
@@ -1,30 +1,130 @@
 package http
 
 import (
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
 	"go.uber.org/zap"
 )
 
+// withContext sets a request scoped context which is propagated down to the data layer,
+// so the work of a request is canceled once its deadline is exceeded, the client disconnects
+// or the server shuts down.
+func (s *Server) withContext(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), s.config.RequestTimeout)
+	defer cancel()
+	defer watchDisconnect(c.Context().Conn(), cancel)()
+
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// sessionCookie carries the time of the client's latest write (in unix nanoseconds),
+// so its reads observe its writes even when they're served by another instance.
+const sessionCookie = "last_write"
+
+// withSession routes the reads of the request by the latest write of the client, and
+// hands the time of the writes made by the request back to the client.
+func (s *Server) withSession(c *fiber.Ctx) error {
+	var wroteAt time.Time
+	if nanos, err := strconv.ParseInt(c.Cookies(sessionCookie), 10, 64); err == nil && nanos > 0 {
+		wroteAt = time.Unix(0, nanos)
+	}
+
+	ctx, session := repository.WithSession(c.UserContext(), wroteAt)
+	c.SetUserContext(ctx)
+
+	// the writes may have been committed even if the request has failed afterwards
+	err := c.Next()
+	if latest := session.WroteAt(); latest.After(wroteAt) {
+		c.Cookie(&fiber.Cookie{
+			Name: sessionCookie, Value: strconv.FormatInt(latest.UnixNano(), 10),
+			Path: "/", HTTPOnly: true, SameSite: fiber.CookieSameSiteLaxMode,
+		})
+	}
+	return err
+}
+
 func (s *Server) fetchUserId(c *fiber.Ctx) error {
 	headerBytes := c.Request().Header.Peek("Authorization")
 	header := strings.TrimPrefix(string(headerBytes), "Bearer ")
 
 	if len(header) == 0 {
 		s.logger.Error("Missing authorization header")
-		response := "please provide your authentication information"
-		return c.Status(http.StatusUnauthorized).SendString(response)
+		return problem(CodeUnauthenticated, "please provide your authentication information")
 	}
 
-	var id uint64
-	if err := s.token.ExtractTokenData(string(header), &id); err != nil || id == 0 {
+	claims := &models.Claims{}
+	err := s.token.ExtractTokenData(c.UserContext(), string(header), claims)
+	if err != nil || claims.UserId == 0 || claims.OrganizationId == 0 {
 		s.logger.Error("Invalid token header", zap.Error(err))
-		response := "invalid token header, please login again"
-		return c.Status(http.StatusBadRequest).SendString(response)
+		return problem(CodeInvalidToken, "invalid token header, please login again")
+	}
+
+	// the tokens of an organization can't be used on the subdomain of another one
+	if slug := s.subdomain(c); len(slug) != 0 && slug != claims.Organization {
+		s.logger.Error("Token of another organization", zap.String("subdomain", slug), zap.Any("claims", claims))
+		return problem(CodeWrongOrganization, "the token doesn't belong to this organization")
+	}
+
+	c.Locals("user-id", claims.UserId)
+	c.SetUserContext(repository.WithOrganization(c.UserContext(), claims.OrganizationId))
+	return c.Next()
+}
+
+// resolveOrganization finds the organization of the unauthenticated requests by their subdomain
+func (s *Server) resolveOrganization(c *fiber.Ctx) error {
+	slug := s.subdomain(c)
+	if len(slug) == 0 {
+		slug = s.config.DefaultOrganization
+	}
+
+	org, err := s.repository.GetOrganizationBySlug(c.UserContext(), slug)
+	if errors.Is(err, rdbms.ErrNotFound) {
+		return problem(CodeOrganizationNotFound, fmt.Sprintf("The organization (%s) doesn't exists", slug))
+	} else if err != nil {
+		s.logger.Error("Error happened while getting the organization", zap.String("slug", slug), zap.Error(err))
+		return failure(err)
 	}
 
-	c.Locals("user-id", id)
+	c.Locals("organization", org)
+	c.SetUserContext(repository.WithOrganization(c.UserContext(), org.Id))
 	return c.Next()
 }
+
+// subdomain returns the slug of the organization given by the host, if there's any
+func (s *Server) subdomain(c *fiber.Ctx) string {
+	if len(s.config.Domain) == 0 {
+		return ""
+	}
+
+	host, _, _ := strings.Cut(c.Hostname(), ":")
+	slug, ok := strings.CutSuffix(strings.ToLower(host), "."+s.config.Domain)
+	if !ok || strings.Contains(slug, ".") {
+		return ""
+	}
+	return slug
+}
+
+// limitBody rejects the requests whose body is larger than the size
+func (s *Server) limitBody(size int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(c.Request().Body()) > size {
+			return problem(CodePayloadTooLarge, fmt.Sprintf("The request body exceeds the maximum size of %d bytes", size))
+		}
+		return c.Next()
+	}
+}
+
+// photoBodySize leaves room for the multipart envelope around the photo
+func photoBodySize(cfg *Config) int {
+	return cfg.PhotoMaxSize + 64*1024
+}
@@ -0,0 +1,554 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/thumbnail"
+	"github.com/mohammadne/phone-book/pkg/validate"
+)
+
+// operation documents a route of the client app, the OpenAPI document is generated by walking
+// the routes registered on the app so only what the router can't tell is declared here.
+type operation struct {
+	tag      string
+	summary  string
+	auth     bool // requires a bearer token
+	query    []parameter
+	request  any // a value of the JSON body, a string for plain texts or a content of the other types
+	status   int
+	response any
+	others   map[int]any // the responses other than the main one and the problems
+	errors   []Code
+}
+
+type parameter struct {
+	name        string
+	description string
+	schema      schema
+}
+
+// schema is a JSON schema given as is, the other values are reflected into their schemas
+type schema map[string]any
+
+// content is a body of media types other than JSON, by the schema of each one
+type content map[string]schema
+
+var (
+	binary = schema{"type": "string", "format": "binary"}
+	text   = "plain text" // any string is a plain text body
+
+	listingQuery = []parameter{
+		{"cursor", "cursor of the page, as given by the previous page", schema{"type": "string"}},
+		{"limit", "number of the contacts of the page", schema{"type": "integer", "minimum": 1}},
+		{"search", "only the contacts whose name or phones contain it", schema{"type": "string"}},
+		{"tag", "only the contacts tagged with the tag name", schema{"type": "string"}},
+		{"total", "also count all of the matching contacts", schema{"type": "boolean"}},
+	}
+	listingErrors = []Code{CodeInvalidCursor}
+
+	contactErrors = []Code{CodeInvalidParameter, CodeContactNotFound}
+	bodyErrors    = []Code{CodeInvalidBody, CodeValidation}
+	tagErrors     = []Code{CodeInvalidParameter, CodeTagNotFound}
+)
+
+// operations are keyed by the method and the path of their routes, as they're registered
+var operations = map[string]operation{
+	"POST /api/v1/auth/register": {
+		tag: "auth", summary: "Register a user in the organization of the request",
+		request: registration{}, status: http.StatusCreated, response: tokenResponse{},
+		errors: append(bodyErrors, CodeOrganizationNotFound, CodeEmailTaken, CodeUsersLimit),
+	},
+	"POST /api/v1/auth/login": {
+		tag: "auth", summary: "Login to the organization of the request",
+		request: credentials{}, status: http.StatusOK, response: tokenResponse{},
+		errors: append(bodyErrors, CodeOrganizationNotFound, CodeWrongCredentials),
+	},
+	`POST /api/v1/contacts\:batch`: {
+		tag: "contacts", summary: "Create, update and delete contacts at once", auth: true,
+		request: batchRequest{}, status: http.StatusOK, response: batchResponse{},
+		others: map[int]any{http.StatusConflict: batchResponse{}}, // an atomic batch has failed
+		errors: []Code{CodeInvalidBody, CodeInvalidBatch},
+	},
+	"GET /api/v1/contacts/": {
+		tag: "contacts", summary: "List the contacts", auth: true, query: listingQuery,
+		status: http.StatusOK, response: models.ContactsPage{}, errors: listingErrors,
+	},
+	"GET /api/v1/contacts/favorites": {
+		tag: "contacts", summary: "List the favorite contacts", auth: true, query: listingQuery,
+		status: http.StatusOK, response: models.ContactsPage{}, errors: listingErrors,
+	},
+	"GET /api/v1/contacts/recent": {
+		tag: "contacts", summary: "List the contacts by the last time being used", auth: true, query: listingQuery,
+		status: http.StatusOK, response: models.ContactsPage{}, errors: listingErrors,
+	},
+	"GET /api/v1/contacts/trash": {
+		tag: "contacts", summary: "List the deleted contacts waiting to be purged", auth: true, query: listingQuery,
+		status: http.StatusOK, response: models.ContactsPage{}, errors: listingErrors,
+	},
+	"POST /api/v1/contacts/": {
+		tag: "contacts", summary: "Create a contact", auth: true,
+		request: models.Contact{}, status: http.StatusCreated, response: text,
+		errors: append(bodyErrors, CodeContactsLimit),
+	},
+	"GET /api/v1/contacts/:id": {
+		tag: "contacts", summary: "Get a contact", auth: true,
+		status: http.StatusOK, response: models.Contact{}, others: map[int]any{http.StatusNotModified: nil},
+		errors: contactErrors,
+	},
+	"PUT /api/v1/contacts/:id": {
+		tag: "contacts", summary: "Update a contact, the empty fields are left untouched", auth: true,
+		request: models.Contact{}, status: http.StatusOK, response: text,
+		errors: append(contactErrors, CodeInvalidBody, CodeValidation, CodeVersionMismatch, CodeConflict),
+	},
+	"PATCH /api/v1/contacts/:id": {
+		tag: "contacts", summary: "Patch a contact by a merge patch or a JSON patch", auth: true,
+		request: content{
+			MIMEMergePatch: reflected(patchableContact{}),
+			MIMEJSONPatch:  schema{"type": "array", "items": schema{"type": "object"}},
+		},
+		status: http.StatusOK, response: text,
+		errors: append(contactErrors, CodeUnsupportedMedia, CodeInvalidPatch, CodePatchTestFailed,
+			CodePatchNotApplicable, CodeInvalidContact, CodeValidation, CodeVersionMismatch, CodeConflict),
+	},
+	"DELETE /api/v1/contacts/:id": {
+		tag: "contacts", summary: "Move a contact to the trash", auth: true,
+		status: http.StatusOK, response: text, errors: append(contactErrors, CodeVersionMismatch),
+	},
+	"POST /api/v1/contacts/:id/restore": {
+		tag: "contacts", summary: "Restore a contact from the trash", auth: true,
+		status: http.StatusOK, response: text, errors: contactErrors,
+	},
+	"GET /api/v1/contacts/:id/revisions": {
+		tag: "revisions", summary: "List the revisions of a contact, the newest first", auth: true,
+		query: []parameter{
+			{"limit", "number of the revisions", schema{"type": "integer", "minimum": 1}},
+			{"before", "only the revisions older than the version", schema{"type": "integer", "minimum": 1}},
+		},
+		status: http.StatusOK, response: revisionsResponse{}, errors: contactErrors,
+	},
+	"POST /api/v1/contacts/:id/revisions/:revision/revert": {
+		tag: "revisions", summary: "Revert a contact to one of its revisions", auth: true,
+		status: http.StatusOK, response: models.Contact{},
+		errors: append(contactErrors, CodeRevisionNotFound, CodeContactsLimit),
+	},
+	"PUT /api/v1/contacts/:id/favorite": {
+		tag: "contacts", summary: "Mark a contact as favorite", auth: true,
+		status: http.StatusNoContent, errors: contactErrors,
+	},
+	"DELETE /api/v1/contacts/:id/favorite": {
+		tag: "contacts", summary: "Unmark a favorite contact", auth: true,
+		status: http.StatusNoContent, errors: contactErrors,
+	},
+	"POST /api/v1/contacts/:id/use": {
+		tag: "contacts", summary: "Record a usage of a contact", auth: true,
+		status: http.StatusNoContent, errors: contactErrors,
+	},
+	"GET /api/v1/contacts/:id/photo": {
+		tag: "photos", summary: "Get the photo of a contact or one of its thumbnails", auth: true,
+		query:  []parameter{{"size", "the thumbnail size", sizes()}},
+		status: http.StatusOK, response: content{"image/*": binary},
+		errors: append(contactErrors, CodePhotoNotFound),
+	},
+	"PUT /api/v1/contacts/:id/photo": {
+		tag: "photos", summary: "Upload the photo of a contact, either as a multipart field or the raw body", auth: true,
+		request: content{
+			fiber.MIMEMultipartForm: schema{"type": "object", "properties": schema{"photo": binary}, "required": []string{"photo"}},
+			"image/*":               binary,
+		},
+		status: http.StatusCreated, response: text,
+		errors: append(contactErrors, CodeInvalidBody, CodePayloadTooLarge, CodeUnsupportedMedia, CodeInvalidPhoto),
+	},
+	"DELETE /api/v1/contacts/:id/photo": {
+		tag: "photos", summary: "Remove the photo of a contact", auth: true,
+		status: http.StatusOK, response: text, errors: append(contactErrors, CodePhotoNotFound),
+	},
+	"GET /api/v1/contacts/:id/vcard": {
+		tag: "contacts", summary: "Export a contact as a vCard", auth: true,
+		status: http.StatusOK, response: content{"text/vcard": schema{"type": "string"}}, errors: contactErrors,
+	},
+	"GET /api/v1/tags/": {
+		tag: "tags", summary: "List the tags", auth: true,
+		status: http.StatusOK, response: tagsResponse{},
+	},
+	"POST /api/v1/tags/": {
+		tag: "tags", summary: "Create a tag", auth: true,
+		request: models.Tag{}, status: http.StatusCreated, response: models.Tag{},
+		errors: append(bodyErrors, CodeTagExists, CodeTagsLimit),
+	},
+	"PUT /api/v1/tags/:id": {
+		tag: "tags", summary: "Update a tag, the empty fields are left untouched", auth: true,
+		request: models.Tag{}, status: http.StatusOK, response: models.Tag{},
+		errors: append(tagErrors, CodeInvalidBody, CodeValidation, CodeTagExists),
+	},
+	"DELETE /api/v1/tags/:id": {
+		tag: "tags", summary: "Delete a tag, the contacts are left untouched", auth: true,
+		status: http.StatusOK, response: text, errors: tagErrors,
+	},
+	"POST /api/v1/tags/:id/contacts": {
+		tag: "tags", summary: "Tag the contacts", auth: true,
+		request: tagContactsRequest{}, status: http.StatusOK, response: text,
+		errors: append(tagErrors, CodeInvalidBody),
+	},
+	"DELETE /api/v1/tags/:id/contacts": {
+		tag: "tags", summary: "Untag the contacts", auth: true,
+		request: tagContactsRequest{}, status: http.StatusOK, response: text,
+		errors: append(tagErrors, CodeInvalidBody),
+	},
+}
+
+// sizes is the schema of the photo sizes, the original one along with the thumbnails
+func sizes() schema {
+	enum := []string{string(thumbnail.Original)}
+	for size := range thumbnail.Sizes {
+		enum = append(enum, string(size))
+	}
+	sort.Strings(enum[1:])
+	return schema{"type": "string", "enum": enum, "default": thumbnail.Original}
+}
+
+// OpenAPI returns the OpenAPI document of the client app, along with an error listing the routes
+// and the operations which diverge. The document is still usable when they diverge, it just
+// lacks the undocumented routes.
+func (s *Server) OpenAPI() ([]byte, error) {
+	components := schemas{}
+	paths := map[string]map[string]any{}
+
+	var undocumented, unrouted []string
+	routed := map[string]bool{}
+	for _, route := range s.clientApp.GetRoutes(true) {
+		// fiber adds a HEAD route for every GET one
+		if route.Method == fiber.MethodHead {
+			continue
+		}
+
+		key := route.Method + " " + route.Path
+		routed[key] = true
+
+		op, ok := operations[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			continue
+		}
+
+		path, params := openapiPath(route.Path)
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = components.operation(op, params)
+	}
+
+	for key := range operations {
+		if !routed[key] {
+			unrouted = append(unrouted, key)
+		}
+	}
+
+	components.reflect(reflect.TypeOf(Problem{}))
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "PhoneBook",
+			"version":     "v1",
+			"description": "The errors are RFC 7807 problems, identified by their stable codes.",
+		},
+		"servers": []any{map[string]any{"url": s.config.ClientURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": components,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+
+	body, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(undocumented) != 0 || len(unrouted) != 0 {
+		sort.Strings(undocumented)
+		sort.Strings(unrouted)
+		return body, fmt.Errorf("Error OpenAPI document diverges from the routes, undocumented routes: [%s], operations without any route: [%s]",
+			strings.Join(undocumented, ", "), strings.Join(unrouted, ", "))
+	}
+	return body, nil
+}
+
+// openapiPath converts the path of a route into a templated path along with its parameters,
+// like /contacts/:id/ into /contacts/{id}
+func openapiPath(route string) (string, []string) {
+	segments := strings.Split(strings.TrimSuffix(route, "/"), "/")
+
+	var params []string
+	for index, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[index] = "{" + segment[1:] + "}"
+		}
+		segments[index] = strings.ReplaceAll(segments[index], `\:`, ":")
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// schemas are the component schemas, by the names of their types
+type schemas map[string]any
+
+func (components schemas) operation(op operation, params []string) map[string]any {
+	parameters := []any{}
+	for _, param := range params {
+		parameters = append(parameters, map[string]any{
+			"name": param, "in": "path", "required": true,
+			"schema": schema{"type": "integer", "format": "int64", "minimum": 1},
+		})
+	}
+	for _, param := range op.query {
+		parameters = append(parameters, map[string]any{
+			"name": param.name, "in": "query", "description": param.description, "schema": param.schema,
+		})
+	}
+
+	responses := map[string]any{strconv.Itoa(op.status): components.response(op.status, op.response)}
+	for status, body := range op.others {
+		responses[strconv.Itoa(status)] = components.response(status, body)
+	}
+
+	errs := append([]Code{}, op.errors...)
+	if op.auth {
+		errs = append(errs, CodeUnauthenticated, CodeInvalidToken, CodeWrongOrganization)
+	}
+	errs = append(errs, CodeInternal, CodeTimeout)
+
+	// the problems of the same status share a response, the codes tell them apart
+	byStatus := map[int][]string{}
+	for _, code := range errs {
+		status := codes[code].status
+		byStatus[status] = append(byStatus[status], string(code))
+	}
+	for status, enum := range byStatus {
+		responses[strconv.Itoa(status)] = map[string]any{
+			"description": http.StatusText(status) + ": " + strings.Join(enum, ", "),
+			"content": map[string]any{MIMEProblemJSON: map[string]any{"schema": schema{
+				"allOf":      []any{components.reflect(reflect.TypeOf(Problem{}))},
+				"properties": schema{"code": schema{"enum": enum}},
+			}}},
+		}
+	}
+
+	result := map[string]any{
+		"tags":       []string{op.tag},
+		"summary":    op.summary,
+		"parameters": parameters,
+		"responses":  responses,
+	}
+	if op.request != nil {
+		result["requestBody"] = map[string]any{"required": true, "content": components.content(op.request)}
+	}
+	if op.auth {
+		result["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+	}
+	return result
+}
+
+func (components schemas) response(status int, body any) map[string]any {
+	response := map[string]any{"description": http.StatusText(status)}
+	if body != nil {
+		response["content"] = components.content(body)
+	}
+	return response
+}
+
+func (components schemas) content(body any) map[string]any {
+	result := map[string]any{}
+	switch body := body.(type) {
+	case content:
+		for mime, schema := range body {
+			result[mime] = map[string]any{"schema": schema}
+		}
+	case string:
+		result[fiber.MIMETextPlainCharsetUTF8] = map[string]any{"schema": schema{"type": "string"}}
+	default:
+		result[fiber.MIMEApplicationJSON] = map[string]any{"schema": components.reflect(reflect.TypeOf(body))}
+	}
+	return result
+}
+
+// reflected returns the schema of a value whose structs are all inlined
+func reflected(value any) schema {
+	return schemas{}.inline(reflect.TypeOf(value))
+}
+
+// reflect returns the schema of the type, the structs are added to the components and referenced
+func (components schemas) reflect(t reflect.Type) schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return components.inline(t)
+	}
+
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	if _, ok := components[string(name)]; !ok {
+		components[string(name)] = schema{} // placeholder for the recursive types
+		components[string(name)] = components.object(t)
+	}
+	return schema{"$ref": "#/components/schemas/" + string(name)}
+}
+
+// inline returns the schema of the type without referencing any component, unless it's a field of a struct
+func (components schemas) inline(t reflect.Type) schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return schema{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		return components.object(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return schema{"type": "array", "items": components.reflect(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": components.reflect(t.Elem())}
+	default:
+		return schema{} // any value
+	}
+}
+
+// object returns the schema of the struct by the json names of its fields, the embedded
+// structs are flattened as encoding/json does and the validate tags become the constraints.
+func (components schemas) object(t reflect.Type) schema {
+	properties, required := schema{}, []string{}
+
+	var fields func(t reflect.Type)
+	fields = func(t reflect.Type) {
+		for index := 0; index < t.NumField(); index++ {
+			field := t.Field(index)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			} else if field.Anonymous && len(name) == 0 && field.Type.Kind() == reflect.Struct {
+				fields(field.Type)
+				continue
+			} else if !field.IsExported() {
+				continue
+			} else if len(name) == 0 {
+				name = field.Name
+			}
+
+			property := components.reflect(field.Type)
+			if tag, ok := field.Tag.Lookup("validate"); ok {
+				if constrain(property, strings.Split(tag, ",")) {
+					required = append(required, name)
+				}
+			}
+			properties[name] = property
+		}
+	}
+	fields(t)
+
+	result := schema{"type": "object", "properties": properties}
+	if len(required) != 0 {
+		result["required"] = required
+	}
+	return result
+}
+
+// constrain adds the rules of a validate tag to the schema, it returns whether the rules require the value
+func constrain(property schema, rules []string) bool {
+	required := false
+	for index, rule := range rules {
+		if rule == "dive" {
+			if items, ok := property["items"].(schema); ok {
+				constrain(items, rules[index+1:])
+			}
+			break
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		limit, _ := strconv.Atoi(param)
+		array := property["type"] == "array"
+		switch {
+		case name == "required":
+			required = true
+			if array {
+				property["minItems"] = 1
+			} else if property["type"] == "string" {
+				property["minLength"] = 1
+			}
+		case name == "min" && array:
+			property["minItems"] = limit
+		case name == "min":
+			property["minLength"] = limit
+		case name == "max" && array:
+			property["maxItems"] = limit
+		case name == "max":
+			property["maxLength"] = limit
+		case name == "email":
+			property["format"] = "email"
+		default:
+			if pattern, ok := validate.Pattern(name); ok {
+				property["pattern"] = pattern
+			}
+		}
+	}
+	return required
+}
+
+func (handler *Server) openapi(c *fiber.Ctx) error {
+	if handler.document == nil {
+		return problem(CodeInternal, "")
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	return c.Status(http.StatusOK).Send(handler.document)
+}
+
+// docs redirects to the trailing slash, so the relative assets of the swagger ui resolve under it
+func (handler *Server) docs(c *fiber.Ctx) error {
+	if c.Path() == "/docs" {
+		return c.Redirect("/docs/", http.StatusMovedPermanently)
+	}
+	return c.Next()
+}
+
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+func (handler *Server) swaggerInitializer(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJavaScriptCharsetUTF8)
+	return c.Status(http.StatusOK).SendString(swaggerInitializer)
+}
@@ -0,0 +1,54 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+func testConfig() *Config {
+	return &Config{
+		BodyMaxSize:    1024 * 1024,
+		PhotoMaxSize:   5 * 1024 * 1024,
+		BatchMaxSize:   1000,
+		RequestTimeout: time.Second,
+		ClientURL:      "http://localhost:8081",
+	}
+}
+
+// TestOpenAPI fails when a route or an operation is added without its counterpart
+func TestOpenAPI(t *testing.T) {
+	server, err := New(testConfig(), zap.NewNop(), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := server.OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(document, &parsed); err != nil {
+		t.Fatalf("OpenAPI document isn't valid json: %v", err)
+	} else if len(parsed.Paths) == 0 {
+		t.Fatal("OpenAPI document has no path")
+	}
+}
+
+func TestOpenAPIDivergence(t *testing.T) {
+	server, err := New(testConfig(), zap.NewNop(), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.clientApp.Get("/api/v1/undocumented", func(c *fiber.Ctx) error { return nil })
+	if _, err := server.OpenAPI(); err == nil {
+		t.Fatal("OpenAPI document doesn't report the undocumented route")
+	}
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// setPaginationLinks sets the RFC 8288 Link header of a paginated listing,
+// the links keep every query parameter of the current request except the cursor.
+func setPaginationLinks(c *fiber.Ctx, next, prev string) {
+	base := c.BaseURL() + c.Path()
+
+	link := func(cursor, rel string) string {
+		query := url.Values{}
+		c.Context().QueryArgs().VisitAll(func(key, value []byte) {
+			if string(key) != "cursor" {
+				query.Add(string(key), string(value))
+			}
+		})
+
+		if len(cursor) != 0 {
+			query.Set("cursor", cursor)
+		}
+
+		target := base
+		if encoded := query.Encode(); len(encoded) != 0 {
+			target += "?" + encoded
+		}
+
+		return fmt.Sprintf(`<%s>; rel="%s"`, target, rel)
+	}
+
+	links := []string{link("", "first")}
+	if len(next) != 0 {
+		links = append(links, link(next, "next"))
+	}
+	if len(prev) != 0 {
+		links = append(links, link(prev, "prev"))
+	}
+
+	c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+}
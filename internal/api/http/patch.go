@@ -0,0 +1,119 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/jsonpatch"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+
+	// patching is retried when the contact is modified concurrently and no If-Match is given
+	patchAttempts = 3
+)
+
+// patchableContact is the document which the patches are applied to,
+// a missing or null member after applying the patch clears the field.
+type patchableContact struct {
+	Name        string   `json:"name"`
+	Phones      []string `json:"phones"`
+	Description string   `json:"description"`
+}
+
+func (handler *Server) patchContact(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	var apply func(document, patch []byte) ([]byte, error)
+	switch contentType := strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]); contentType {
+	case MIMEMergePatch:
+		apply = jsonpatch.MergePatch
+	case MIMEJSONPatch:
+		apply = jsonpatch.Apply
+	default:
+		response := fmt.Sprintf("Unsupported patch content type, use %s or %s", MIMEMergePatch, MIMEJSONPatch)
+		c.Set("Accept-Patch", MIMEMergePatch+", "+MIMEJSONPatch)
+		return problem(CodeUnsupportedMedia, response)
+	}
+
+	for attempt := 1; ; attempt++ {
+		oldContact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
+		if err != nil {
+			if errors.Is(err, rdbms.ErrNotFound) {
+				return problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+			}
+
+			errString := "Error happened while getting the contact"
+			handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+			return failure(err)
+		}
+
+		if _, ok := checkIfMatch(c, oldContact); !ok {
+			return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
+		}
+
+		document, _ := json.Marshal(&patchableContact{oldContact.Name, oldContact.Phones, oldContact.Description})
+		patched, err := apply(document, c.Body())
+		if errors.Is(err, jsonpatch.ErrInvalidPatch) {
+			return problem(CodeInvalidPatch, err.Error())
+		} else if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return problem(CodePatchTestFailed, err.Error())
+		} else if err != nil {
+			return problem(CodePatchNotApplicable, err.Error())
+		}
+
+		result := &patchableContact{}
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(result); err != nil {
+			return problem(CodeInvalidContact, fmt.Sprintf("The patched contact is invalid: %v", err))
+		}
+
+		newContact := &models.Contact{Id: contactId, Name: result.Name, Phones: result.Phones, Description: result.Description}
+		newContact.Favorite, newContact.UsageCount = oldContact.Favorite, oldContact.UsageCount
+		if err := newContact.Validate(); err != nil {
+			handler.logger.Error("Error invalid contact is resulted from the patch", zap.Any("contact", newContact), zap.Error(err))
+			return invalid(err)
+		}
+
+		// the patch has been applied on this version, so it's always conditioned on it
+		err = handler.repository.UpdateContact(c.UserContext(), userId, newContact, oldContact.Version)
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			if len(c.Get(fiber.HeaderIfMatch)) == 0 && attempt < patchAttempts {
+				continue
+			}
+
+			return problem(CodeVersionMismatch, "The contact has been modified since it was fetched")
+		} else if err != nil {
+			errString := "Error happened while patching the contact"
+			handler.logger.Error(errString, zap.Any("contact", newContact), zap.Error(err))
+			return failure(err)
+		}
+
+		c.Set(fiber.HeaderETag, contactETag(newContact))
+		response := "Contact has been patched successfully"
+		return c.Status(http.StatusOK).SendString(response)
+	}
+}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/storage"
+	"github.com/mohammadne/phone-book/pkg/thumbnail"
+	"go.uber.org/zap"
+)
+
+// contactForPhoto resolves the contact of the photo endpoints, the returned
+// error is already the response to be sent when the contact is nil.
+func (handler *Server) contactForPhoto(c *fiber.Ctx) (uint64, *models.Contact, error) {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return 0, nil, problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return 0, nil, problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	contact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
+	if err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return 0, nil, problem(CodeContactNotFound, fmt.Sprintf("The given contact id (%d) doesn't exists", contactId))
+		}
+
+		errString := "Error happened while getting the contact"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return 0, nil, failure(err)
+	}
+
+	return userId, contact, nil
+}
+
+// readPhoto returns the uploaded photo either from the "photo" multipart field or the raw body
+func (handler *Server) readPhoto(c *fiber.Ctx) ([]byte, error) {
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		return c.Body(), nil
+	}
+
+	header, err := c.FormFile("photo")
+	if err != nil {
+		return nil, err
+	} else if header.Size > int64(handler.config.PhotoMaxSize) {
+		return nil, fiber.ErrRequestEntityTooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, int64(handler.config.PhotoMaxSize)+1))
+}
+
+func (handler *Server) uploadPhoto(c *fiber.Ctx) error {
+	userId, contact, err := handler.contactForPhoto(c)
+	if contact == nil {
+		return err
+	}
+
+	data, err := handler.readPhoto(c)
+	if errors.Is(err, fiber.ErrRequestEntityTooLarge) || len(data) > handler.config.PhotoMaxSize {
+		return problem(CodePayloadTooLarge, fmt.Sprintf("The photo exceeds the maximum size of %d bytes", handler.config.PhotoMaxSize))
+	} else if err != nil || len(data) == 0 {
+		errString := "Error reading the uploaded photo"
+		handler.logger.Error(errString, zap.Error(err))
+		return problem(CodeInvalidBody, errString)
+	}
+
+	contentType, err := thumbnail.DetectContentType(data)
+	if err != nil {
+		return problem(CodeUnsupportedMedia, err.Error())
+	}
+
+	thumbnails, err := thumbnail.Generate(data)
+	if err != nil {
+		handler.logger.Error("Error generating thumbnails", zap.Uint64("contact-id", contact.Id), zap.Error(err))
+		return problem(CodeInvalidPhoto, err.Error())
+	}
+
+	// every upload gets a new prefix, so the old photo is kept until the new one is stored completely
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return failure(err)
+	}
+	prefix := fmt.Sprintf("contacts/%d/%d/%s", userId, contact.Id, hex.EncodeToString(random))
+
+	if err := handler.storage.Put(prefix+"/"+string(thumbnail.Original), data, contentType); err != nil {
+		errString := "Error happened while storing the photo"
+		handler.logger.Error(errString, zap.String("prefix", prefix), zap.Error(err))
+		return failure(err)
+	}
+
+	for size, thumbnailData := range thumbnails {
+		if err := handler.storage.Put(prefix+"/"+string(size), thumbnailData, "image/jpeg"); err != nil {
+			errString := "Error happened while storing the photo thumbnail"
+			handler.logger.Error(errString, zap.String("prefix", prefix), zap.Error(err))
+			handler.deletePhoto(prefix)
+			return failure(err)
+		}
+	}
+
+	if err := handler.repository.SetContactPhoto(c.UserContext(), userId, contact.Id, prefix); err != nil {
+		errString := "Error happened while updating the contact photo"
+		handler.logger.Error(errString, zap.Uint64("contact-id", contact.Id), zap.Error(err))
+		handler.deletePhoto(prefix)
+		return failure(err)
+	}
+
+	if len(contact.Photo) != 0 {
+		handler.deletePhoto(contact.Photo)
+	}
+
+	response := "Photo has been uploaded successfully"
+	return c.Status(http.StatusCreated).SendString(response)
+}
+
+func (handler *Server) getPhoto(c *fiber.Ctx) error {
+	_, contact, err := handler.contactForPhoto(c)
+	if contact == nil {
+		return err
+	}
+
+	size := c.Query("size", string(thumbnail.Original))
+	if _, ok := thumbnail.Sizes[thumbnail.Size(size)]; !ok && size != string(thumbnail.Original) {
+		return problem(CodeInvalidParameter, fmt.Sprintf("Invalid photo size (%s) has been given", size))
+	}
+
+	if len(contact.Photo) == 0 {
+		return problem(CodePhotoNotFound, "The contact doesn't have any photo")
+	}
+
+	data, contentType, err := handler.storage.Get(contact.Photo + "/" + size)
+	if errors.Is(err, storage.ErrNotFound) {
+		return problem(CodePhotoNotFound, "The contact doesn't have any photo")
+	} else if err != nil {
+		errString := "Error happened while reading the photo"
+		handler.logger.Error(errString, zap.String("prefix", contact.Photo), zap.Error(err))
+		return failure(err)
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	return c.Status(http.StatusOK).Send(data)
+}
+
+func (handler *Server) removePhoto(c *fiber.Ctx) error {
+	userId, contact, err := handler.contactForPhoto(c)
+	if contact == nil {
+		return err
+	}
+
+	if len(contact.Photo) == 0 {
+		return problem(CodePhotoNotFound, "The contact doesn't have any photo")
+	}
+
+	if err := handler.repository.SetContactPhoto(c.UserContext(), userId, contact.Id, ""); err != nil {
+		errString := "Error happened while removing the contact photo"
+		handler.logger.Error(errString, zap.Uint64("contact-id", contact.Id), zap.Error(err))
+		return failure(err)
+	}
+	handler.deletePhoto(contact.Photo)
+
+	response := "Photo has been deleted successfully"
+	return c.Status(http.StatusOK).SendString(response)
+}
+
+// deletePhoto removes the original photo and its thumbnails, failures are only
+// logged because the photo is not referenced by the contact anymore.
+func (handler *Server) deletePhoto(prefix string) {
+	for _, key := range thumbnail.Keys(prefix) {
+		if err := handler.storage.Delete(key); err != nil {
+			handler.logger.Error("Error deleting photo object", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+func (handler *Server) exportVCard(c *fiber.Ctx) error {
+	_, contact, err := handler.contactForPhoto(c)
+	if contact == nil {
+		return err
+	}
+
+	var photo []byte
+	if len(contact.Photo) != 0 {
+		photo, _, err = handler.storage.Get(contact.Photo + "/" + string(thumbnail.Medium))
+		if err != nil {
+			handler.logger.Error("Error reading photo for vcard", zap.String("prefix", contact.Photo), zap.Error(err))
+		}
+	}
+
+	filename := fmt.Sprintf("contact-%d.vcf", contact.Id)
+	c.Set(fiber.HeaderContentType, "text/vcard; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return c.Status(http.StatusOK).SendString(contact.VCard(photo))
+}
@@ -0,0 +1,84 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+type revisionsResponse struct {
+	Revisions []models.Revision `json:"revisions"`
+}
+
+func (handler *Server) getRevisions(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	before, _ := strconv.ParseUint(c.Query("before"), 10, 64)
+
+	revisions, err := handler.repository.GetRevisions(c.UserContext(), userId, contactId, before, limit)
+	if err != nil {
+		errString := "Error happened while getting revisions of the contact"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return failure(err)
+	} else if len(revisions) == 0 && before == 0 {
+		// every contact has its creation revision, so only the missing contacts have none
+		return problem(CodeContactNotFound, fmt.Sprintf("Not found any revision for the given contact id (%d)", contactId))
+	}
+
+	return c.Status(http.StatusOK).JSON(&revisionsResponse{Revisions: revisions})
+}
+
+func (handler *Server) revertContact(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	contactId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || contactId == 0 {
+		handler.logger.Error("Invalid token header", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid contact id in path parameters")
+	}
+
+	revisionId, err := strconv.ParseUint(c.Params("revision"), 10, 64)
+	if err != nil || revisionId == 0 {
+		return problem(CodeInvalidParameter, "Invalid revision id in path parameters")
+	}
+
+	if err := handler.repository.RevertContact(c.UserContext(), userId, contactId, revisionId); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeRevisionNotFound, fmt.Sprintf("The given revision (%d) of contact (%d) doesn't exists", revisionId, contactId))
+		}
+
+		errString := "Error happened while reverting the contact"
+		handler.logger.Error(errString, zap.Uint64("contact-id", contactId), zap.Uint64("revision-id", revisionId), zap.Error(err))
+		return failure(err)
+	}
+
+	contact, err := handler.repository.GetContactById(c.UserContext(), userId, contactId)
+	if err != nil {
+		errString := "Error happened while getting the contact"
+		handler.logger.Error(errString, zap.Uint64("contact-id", contactId), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.Status(http.StatusOK).JSON(contact)
+}
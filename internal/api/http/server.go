@@ -2,50 +2,118 @@ package http
 
 import (
 	"encoding/json"
+	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/mohammadne/phone-book/internal/models"
 	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/storage"
 	"github.com/mohammadne/phone-book/pkg/token"
+	swaggerFiles "github.com/swaggo/files/v2"
 	"go.uber.org/zap"
 )
 
 type Server struct {
+	config     *Config
 	logger     *zap.Logger
 	repository repository.Repository
 	token      token.Token
+	storage    storage.Storage
 
 	managmentApp *fiber.App
 	clientApp    *fiber.App
+
+	document []byte // the OpenAPI document of the client app
 }
 
-func New(log *zap.Logger, repo repository.Repository, token token.Token) *Server {
-	server := &Server{logger: log, repository: repo, token: token}
+// New creates the server and registers its routes, it fails when the routes and their
+// OpenAPI document diverge, so an undocumented route can't be served.
+func New(cfg *Config, log *zap.Logger, repo repository.Repository, token token.Token, storage storage.Storage) (*Server, error) {
+	server := &Server{config: cfg, logger: log, repository: repo, token: token, storage: storage}
 
 	// Managment Endpoints
 
-	server.managmentApp = fiber.New(fiber.Config{JSONEncoder: json.Marshal, JSONDecoder: json.Unmarshal})
+	server.managmentApp = fiber.New(fiber.Config{
+		JSONEncoder: json.Marshal, JSONDecoder: json.Unmarshal,
+		ErrorHandler: server.errorHandler,
+	})
 
 	server.managmentApp.Get("/healthz/liveness", server.liveness)
 	server.managmentApp.Get("/healthz/readiness", server.readiness)
+	server.managmentApp.Get("/openapi.json", server.openapi)
+
+	// the bundled swagger ui, its initializer is replaced to load the document
+	server.managmentApp.Get("/docs/swagger-initializer.js", server.swaggerInitializer)
+	server.managmentApp.Use("/docs", server.docs, filesystem.New(filesystem.Config{
+		Root: http.FS(swaggerFiles.FS), Index: "index.html",
+	}))
 
 	// Client Endpoints
 
-	server.clientApp = fiber.New(fiber.Config{JSONEncoder: json.Marshal, JSONDecoder: json.Unmarshal})
+	// fasthttp reads the bodies before routing, so the server accepts the largest limit of the routes
+	bodyLimit := photoBodySize(cfg)
+	if cfg.BodyMaxSize > bodyLimit {
+		bodyLimit = cfg.BodyMaxSize
+	}
+
+	server.clientApp = fiber.New(fiber.Config{
+		JSONEncoder: json.Marshal, JSONDecoder: json.Unmarshal,
+		ErrorHandler: server.errorHandler,
+		BodyLimit:    bodyLimit,
+	})
+
+	server.clientApp.Use(server.withContext, server.withSession)
 
 	v1 := server.clientApp.Group("api/v1")
 
-	auth := v1.Group("auth")
+	// the routes are matched in the order of registration, so the photo uploads are
+	// registered before the body limit of the others is applied
+	v1.Put("/contacts/:id/photo", server.limitBody(photoBodySize(cfg)), server.fetchUserId, server.uploadPhoto)
+	v1.Use(server.limitBody(cfg.BodyMaxSize))
+
+	auth := v1.Group("auth", server.resolveOrganization)
 	auth.Post("/register", server.register)
 	auth.Post("/login", server.login)
 
+	// the colon of the custom method is escaped, so it's not taken as a parameter
+	v1.Post("/contacts\\:batch", server.fetchUserId, server.batchContacts)
+
 	contacts := v1.Group("contacts", server.fetchUserId)
-	contacts.Get("/", server.getContacts)
+	contacts.Get("/", server.getContacts(models.ListingAll))
+	contacts.Get("/favorites", server.getContacts(models.ListingFavorites))
+	contacts.Get("/recent", server.getContacts(models.ListingRecent))
+	contacts.Get("/trash", server.getContacts(models.ListingTrash))
 	contacts.Post("/", server.createContact)
 	contacts.Get("/:id", server.getContact)
 	contacts.Put("/:id", server.updateContact)
+	contacts.Patch("/:id", server.patchContact)
 	contacts.Delete("/:id", server.deleteContact)
-
-	return server
+	contacts.Post("/:id/restore", server.restoreContact)
+	contacts.Get("/:id/revisions", server.getRevisions)
+	contacts.Post("/:id/revisions/:revision/revert", server.revertContact)
+	contacts.Put("/:id/favorite", server.favoriteContact)
+	contacts.Delete("/:id/favorite", server.favoriteContact)
+	contacts.Post("/:id/use", server.useContact)
+	contacts.Get("/:id/photo", server.getPhoto)
+	contacts.Delete("/:id/photo", server.removePhoto)
+	contacts.Get("/:id/vcard", server.exportVCard)
+
+	tags := v1.Group("tags", server.fetchUserId)
+	tags.Get("/", server.getTags)
+	tags.Post("/", server.createTag)
+	tags.Put("/:id", server.updateTag)
+	tags.Delete("/:id", server.deleteTag)
+	tags.Post("/:id/contacts", server.tagContacts)
+	tags.Delete("/:id/contacts", server.tagContacts)
+
+	document, err := server.OpenAPI()
+	if err != nil {
+		return nil, err
+	}
+	server.document = document
+
+	return server, nil
 }
 
 func (server *Server) Serve() {
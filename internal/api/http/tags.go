@@ -0,0 +1,196 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+type tagsResponse struct {
+	Tags []models.Tag `json:"tags"`
+}
+
+type tagContactsRequest struct {
+	Contacts []uint64 `json:"contacts"`
+}
+
+func (handler *Server) getTags(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	tags, err := handler.repository.GetTags(c.UserContext(), userId)
+	if err != nil {
+		errString := "Error happened while getting tags"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.Status(http.StatusOK).JSON(&tagsResponse{Tags: tags})
+}
+
+func (handler *Server) createTag(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	tag := &models.Tag{}
+	if err := c.BodyParser(tag); err != nil {
+		errString := "Error parsing request body"
+		handler.logger.Error(errString, zap.Any("tag", tag), zap.Error(err))
+		return problem(CodeInvalidBody, errString)
+	}
+	tag.Id = 0
+
+	if err := tag.Validate(); err != nil {
+		handler.logger.Error("Error invalid tag has been given", zap.Any("tag", tag), zap.Error(err))
+		return invalid(err)
+	}
+
+	if err := handler.repository.CreateTag(c.UserContext(), userId, tag); err != nil {
+		if errors.Is(err, repository.ErrTagsLimitExceeded) {
+			return problem(CodeTagsLimit, err.Error())
+		} else if errors.Is(err, rdbms.ErrDuplicate) {
+			return problem(CodeTagExists, fmt.Sprintf("A tag named (%s) already exists", tag.Name))
+		}
+
+		errString := "Error happened while creating the tag"
+		handler.logger.Error(errString, zap.Any("tag", tag), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(tag)
+}
+
+func (handler *Server) updateTag(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	tagId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || tagId == 0 {
+		handler.logger.Error("Invalid tag id", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid tag id in path parameters")
+	}
+
+	oldTag, err := handler.repository.GetTagById(c.UserContext(), userId, tagId)
+	if err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeTagNotFound, fmt.Sprintf("The given tag id (%d) doesn't exists", tagId))
+		}
+
+		errString := "Error happened while getting the tag"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("tag-id", tagId), zap.Error(err))
+		return failure(err)
+	}
+
+	newTag := &models.Tag{}
+	if err := c.BodyParser(newTag); err != nil {
+		errString := "Error parsing request body"
+		handler.logger.Error(errString, zap.Any("tag", newTag), zap.Error(err))
+		return problem(CodeInvalidBody, errString)
+	}
+	newTag.Update(oldTag)
+
+	if err := newTag.Validate(); err != nil {
+		handler.logger.Error("Error invalid tag has been given", zap.Any("tag", newTag), zap.Error(err))
+		return invalid(err)
+	}
+
+	if err := handler.repository.UpdateTag(c.UserContext(), userId, newTag); err != nil {
+		if errors.Is(err, rdbms.ErrDuplicate) {
+			return problem(CodeTagExists, fmt.Sprintf("A tag named (%s) already exists", newTag.Name))
+		}
+
+		errString := "Error happened while updating the tag"
+		handler.logger.Error(errString, zap.Any("tag", newTag), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.Status(http.StatusOK).JSON(newTag)
+}
+
+func (handler *Server) deleteTag(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	tagId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || tagId == 0 {
+		handler.logger.Error("Invalid tag id", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid tag id in path parameters")
+	}
+
+	if err := handler.repository.DeleteTag(c.UserContext(), userId, tagId); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeTagNotFound, fmt.Sprintf("The given tag id (%d) doesn't exists", tagId))
+		}
+
+		errString := "Error happened while deleting the tag"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("tag-id", tagId), zap.Error(err))
+		return failure(err)
+	}
+
+	response := "Tag has been deleted successfully"
+	return c.Status(http.StatusOK).SendString(response)
+}
+
+// tagContacts assigns (POST) or removes (DELETE) the tag to/from the given contacts in bulk
+func (handler *Server) tagContacts(c *fiber.Ctx) error {
+	userId, ok := c.Locals("user-id").(uint64)
+	if !ok || userId == 0 {
+		handler.logger.Error("Invalid user-id local")
+		return problem(CodeInternal, "")
+	}
+
+	tagId, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil || tagId == 0 {
+		handler.logger.Error("Invalid tag id", zap.Error(err))
+		return problem(CodeInvalidParameter, "Invalid tag id in path parameters")
+	}
+
+	request := tagContactsRequest{}
+	if err := c.BodyParser(&request); err != nil || len(request.Contacts) == 0 {
+		errString := "Error parsing request body, a list of contact ids is required"
+		handler.logger.Error(errString, zap.Any("request", request), zap.Error(err))
+		return problem(CodeInvalidBody, errString)
+	}
+
+	if _, err := handler.repository.GetTagById(c.UserContext(), userId, tagId); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
+			return problem(CodeTagNotFound, fmt.Sprintf("The given tag id (%d) doesn't exists", tagId))
+		}
+
+		errString := "Error happened while getting the tag"
+		handler.logger.Error(errString, zap.Uint64("user-id", userId), zap.Uint64("tag-id", tagId), zap.Error(err))
+		return failure(err)
+	}
+
+	operation, response := handler.repository.TagContacts, "Contacts have been tagged successfully"
+	if c.Method() == fiber.MethodDelete {
+		operation, response = handler.repository.UntagContacts, "Contacts have been untagged successfully"
+	}
+
+	if err := operation(c.UserContext(), userId, tagId, request.Contacts); err != nil {
+		errString := "Error happened while changing tags of the contacts"
+		handler.logger.Error(errString, zap.Uint64("tag-id", tagId), zap.Error(err))
+		return failure(err)
+	}
+
+	return c.Status(http.StatusOK).SendString(response)
+}
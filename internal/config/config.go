@@ -1,15 +1,21 @@
 package config
 
 import (
+	"github.com/mohammadne/phone-book/internal/api/http"
+	"github.com/mohammadne/phone-book/internal/purger"
 	"github.com/mohammadne/phone-book/internal/repository"
 	"github.com/mohammadne/phone-book/pkg/logger"
 	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/storage"
 	"github.com/mohammadne/phone-book/pkg/token"
 )
 
 type Config struct {
+	HTTP       *http.Config       `koanf:"http"`
 	Logger     *logger.Config     `koanf:"logger"`
+	Purger     *purger.Config     `koanf:"purger"`
 	RDBMS      *rdbms.Config      `koanf:"rdbms"`
 	Repository *repository.Config `koanf:"repository"`
+	Storage    *storage.Config    `koanf:"storage"`
 	Token      *token.Config      `koanf:"token"`
 }
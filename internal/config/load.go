@@ -39,6 +39,10 @@ func Load(print bool) *Config {
 		log.Fatalf("error unmarshalling config: %v", err)
 	}
 
+	if err := validate(&config); err != nil {
+		log.Fatalf("error validating config: %v", err)
+	}
+
 	if print {
 		// pretty print loaded configuration using provided template
 		log.Printf("%s\n%v\n%s\n", upTemplate, spew.Sdump(config), bottomTemplate)
@@ -63,3 +67,13 @@ func loadConfigmap(k *koanf.Koanf) error {
 
 	return nil
 }
+
+// validate checks the constraints between the sections, each section checks its own values
+func validate(config *Config) error {
+	// the reads of the users have to be kept away from the lagging replicas for as long as they're used
+	if len(config.RDBMS.Replicas) != 0 && config.Repository.WritersTTL < config.RDBMS.Routing.MaxLag {
+		return fmt.Errorf("Error repository writers ttl (%s) is below the max lag of the replicas (%s)",
+			config.Repository.WritersTTL, config.RDBMS.Routing.MaxLag)
+	}
+	return nil
+}
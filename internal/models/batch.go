@@ -0,0 +1,24 @@
+package models
+
+type BatchOp string
+
+const (
+	BatchCreate BatchOp = "create"
+	BatchUpdate BatchOp = "update"
+	BatchDelete BatchOp = "delete"
+)
+
+type BatchOperation struct {
+	Op      BatchOp  `json:"op"`
+	Id      uint64   `json:"id,omitempty"`      // the target contact of update and delete
+	Version uint64   `json:"version,omitempty"` // optional expected version of the target contact
+	Contact *Contact `json:"contact,omitempty"` // the body of create and update
+}
+
+type BatchResult struct {
+	Index   int     `json:"index"`
+	Op      BatchOp `json:"op"`
+	Id      uint64  `json:"id,omitempty"`
+	Version uint64  `json:"version,omitempty"`
+	Err     error   `json:"-"`
+}
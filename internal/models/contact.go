@@ -1,22 +1,43 @@
 package models
 
+import (
+	"time"
+
+	"github.com/mohammadne/phone-book/pkg/validate"
+)
+
+// the limits of the fields match the columns of the contacts table
 type Contact struct {
-	Id          uint64   `json:"id"`
-	Name        string   `json:"name"`
-	Phones      []string `json:"phones"`
-	Description string   `json:"description,omitempty"`
+	Id          uint64     `json:"id"`
+	Name        string     `json:"name" validate:"required,max=50"`
+	Phones      []string   `json:"phones" validate:"required,max=10,dive,required,max=15,phone"`
+	Description string     `json:"description,omitempty" validate:"max=255"`
+	Tags        []string   `json:"tags,omitempty"`
+	Favorite    bool       `json:"favorite"`
+	UsageCount  uint64     `json:"usage_count"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	Photo       string     `json:"-"` // storage key prefix of the photo and its thumbnails
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	Version     uint64     `json:"version"` // incremented on every change of the contact
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Validate returns the validate.Errors of every invalid field of the contact
+func (c *Contact) Validate() error {
+	return validate.Struct(c)
 }
 
 func (c *Contact) IsValid() bool {
-	if len(c.Name) == 0 || len(c.Phones) == 0 {
-		return false
-	}
-	return true
+	return c.Validate() == nil
 }
 
 func (newContact *Contact) Update(oldContact *Contact) {
 	newContact.Id = oldContact.Id
 
+	// the favorite and the usage statistics aren't changed by the updates
+	newContact.Favorite, newContact.UsageCount, newContact.LastUsedAt = oldContact.Favorite, oldContact.UsageCount, oldContact.LastUsedAt
+
 	if len(newContact.Name) == 0 {
 		newContact.Name = oldContact.Name
 	}
@@ -29,3 +50,29 @@ func (newContact *Contact) Update(oldContact *Contact) {
 		newContact.Description = oldContact.Description
 	}
 }
+
+type Listing string
+
+const (
+	ListingAll       Listing = "all"
+	ListingFavorites Listing = "favorites"
+	ListingRecent    Listing = "recent" // ordered by the last time being used
+	ListingTrash     Listing = "trash"  // deleted contacts waiting to be purged
+)
+
+type ContactsQuery struct {
+	Listing Listing
+	Cursor  string
+	Search  string
+	Tag     string // only contacts tagged with the given tag name
+	Limit   int
+	Total   bool // also count all contacts matching the query
+}
+
+type ContactsPage struct {
+	Contacts []Contact `json:"contacts"`
+	Next     string    `json:"cursor,omitempty"`
+	Prev     string    `json:"prev,omitempty"`
+	HasMore  bool      `json:"has_more"`
+	Total    *int      `json:"total,omitempty"`
+}
@@ -1,8 +1,37 @@
 package models
 
+import "time"
+
 type Migrate string
 
 const (
 	Up   Migrate = "up"
 	Down Migrate = "down"
 )
+
+type MigrationState string
+
+const (
+	MigrationApplied  MigrationState = "applied"
+	MigrationPending  MigrationState = "pending"
+	MigrationModified MigrationState = "modified" // applied, but its file has been edited since
+	MigrationMissing  MigrationState = "missing"  // applied, but its file doesn't exist anymore
+)
+
+// Migration is the status of a single versioned migration of the schema
+type Migration struct {
+	Version   uint64
+	Name      string
+	State     MigrationState
+	AppliedAt *time.Time
+}
+
+// MigrationStep is a single migration which is going to be applied in the direction,
+// the conflicts describe the existing rows which would make it fail.
+type MigrationStep struct {
+	Version   uint64
+	Name      string
+	Direction Migrate
+	Statement string
+	Conflicts []string
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Organization is a tenant, it owns users and (through them) contacts and tags
+type Organization struct {
+	Id            uint64    `json:"id"`
+	Slug          string    `json:"slug"` // the subdomain of the organization
+	Name          string    `json:"name"`
+	MaxUsers      *int      `json:"max_users,omitempty"` // nil means unlimited
+	MaxContacts   *int      `json:"max_contacts,omitempty"`
+	UsersCount    int       `json:"users_count"`
+	ContactsCount int       `json:"contacts_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (o *Organization) IsValid() bool {
+	if !slugPattern.MatchString(o.Slug) || len(o.Name) == 0 || len(o.Name) > 100 {
+		return false
+	}
+	return true
+}
+
+// Claims are the data of the authentication tokens
+type Claims struct {
+	UserId         uint64 `json:"user_id"`
+	OrganizationId uint64 `json:"organization_id"`
+	Organization   string `json:"organization"` // slug of the organization
+}
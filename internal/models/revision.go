@@ -0,0 +1,63 @@
+package models
+
+import (
+	"reflect"
+	"time"
+)
+
+type Operation string
+
+const (
+	OperationCreate  Operation = "create"
+	OperationUpdate  Operation = "update"
+	OperationDelete  Operation = "delete"
+	OperationRestore Operation = "restore"
+	OperationRevert  Operation = "revert"
+)
+
+// Revision is an immutable snapshot of the contact right after an operation
+type Revision struct {
+	Id          uint64    `json:"id" db:"id"`
+	Version     uint64    `json:"version" db:"version"` // version of the contact after the operation
+	Operation   Operation `json:"operation" db:"operation"`
+	Name        string    `json:"name" db:"name"`
+	Phones      []string  `json:"phones" db:"phones"`
+	Description string    `json:"description,omitempty" db:"description"`
+	Changes     []Change  `json:"changes"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+type Change struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// Diff sets the field-level changes of the revision against the previous one,
+// all of the fields are changed when there's no previous revision.
+func (r *Revision) Diff(previous *Revision) {
+	var old Revision
+	if previous != nil {
+		old = *previous
+	}
+
+	fields := []struct {
+		name     string
+		old, new any
+	}{
+		{"name", old.Name, r.Name},
+		{"phones", old.Phones, r.Phones},
+		{"description", old.Description, r.Description},
+	}
+
+	r.Changes = []Change{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(field.old, field.new) {
+			change := Change{Field: field.name, Old: field.old, New: field.new}
+			if previous == nil {
+				change.Old = nil
+			}
+			r.Changes = append(r.Changes, change)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "github.com/mohammadne/phone-book/pkg/validate"
+
+type Tag struct {
+	Id    uint64 `json:"id" db:"id"`
+	Name  string `json:"name" db:"name" validate:"required,max=30"`
+	Color string `json:"color" db:"color" validate:"required,color"`
+}
+
+// Validate returns the validate.Errors of every invalid field of the tag
+func (t *Tag) Validate() error {
+	return validate.Struct(t)
+}
+
+func (t *Tag) IsValid() bool {
+	return t.Validate() == nil
+}
+
+func (newTag *Tag) Update(oldTag *Tag) {
+	newTag.Id = oldTag.Id
+
+	if len(newTag.Name) == 0 {
+		newTag.Name = oldTag.Name
+	}
+
+	if len(newTag.Color) == 0 {
+		newTag.Color = oldTag.Color
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+var vCardEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\n", `\n`)
+
+// VCard renders the contact as a vCard 3.0 (RFC 2426), the photo is
+// embedded inline when given and it has to be a JPEG image.
+func (c *Contact) VCard(photo []byte) string {
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"FN:" + vCardEscaper.Replace(c.Name),
+		"N:" + vCardEscaper.Replace(c.Name) + ";;;;",
+	}
+
+	for _, phone := range c.Phones {
+		lines = append(lines, "TEL;TYPE=VOICE:"+vCardEscaper.Replace(phone))
+	}
+
+	if len(c.Description) != 0 {
+		lines = append(lines, "NOTE:"+vCardEscaper.Replace(c.Description))
+	}
+
+	if len(c.Tags) != 0 {
+		categories := make([]string, len(c.Tags))
+		for index, tag := range c.Tags {
+			categories[index] = vCardEscaper.Replace(tag)
+		}
+		lines = append(lines, "CATEGORIES:"+strings.Join(categories, ","))
+	}
+
+	if len(photo) != 0 {
+		lines = append(lines, "PHOTO;ENCODING=b;TYPE=JPEG:"+base64.StdEncoding.EncodeToString(photo))
+	}
+
+	lines = append(lines, "END:VCARD")
+
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(foldVCardLine(line))
+		builder.WriteString("\r\n")
+	}
+	return builder.String()
+}
+
+// foldVCardLine splits lines longer than 75 octets, continuation lines start with a space
+func foldVCardLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var builder strings.Builder
+	for len(line) > limit {
+		cut := limit
+		// don't split a multi-byte character
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		builder.WriteString(line[:cut])
+		builder.WriteString("\r\n ")
+		line = line[cut:]
+	}
+	builder.WriteString(line)
+	return builder.String()
+}
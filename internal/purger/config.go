@@ -0,0 +1,9 @@
+package purger
+
+import "time"
+
+type Config struct {
+	Interval  time.Duration `koanf:"interval"`
+	Retention time.Duration `koanf:"retention"`
+	BatchSize int           `koanf:"batch_size"`
+}
@@ -0,0 +1,79 @@
+package purger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/repository"
+	"github.com/mohammadne/phone-book/pkg/storage"
+	"github.com/mohammadne/phone-book/pkg/thumbnail"
+	"go.uber.org/zap"
+)
+
+// Purger permanently removes the contacts which have been in the trash for longer than the retention
+type Purger struct {
+	config     *Config
+	logger     *zap.Logger
+	repository repository.Repository
+	storage    storage.Storage
+}
+
+func New(cfg *Config, log *zap.Logger, repo repository.Repository, storage storage.Storage) (*Purger, error) {
+	// a missing key leaves them zero, which would panic the ticker or never purge anything
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("Error purger interval must be positive: %s", cfg.Interval)
+	} else if cfg.Retention < 0 {
+		return nil, fmt.Errorf("Error purger retention must not be negative: %s", cfg.Retention)
+	} else if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("Error purger batch size must be positive: %d", cfg.BatchSize)
+	}
+
+	return &Purger{config: cfg, logger: log, repository: repo, storage: storage}, nil
+}
+
+// Start runs the purger periodically in the background
+func (p *Purger) Start() {
+	go func() {
+		ticker := time.NewTicker(p.config.Interval)
+		defer ticker.Stop()
+
+		for ; true; <-ticker.C {
+			p.Purge(context.Background())
+		}
+	}()
+}
+
+// Purge removes the expired contacts in batches until there's nothing left
+func (p *Purger) Purge(ctx context.Context) {
+	var total int
+
+	for {
+		contacts, err := p.repository.PurgeContacts(ctx, p.config.Retention, p.config.BatchSize)
+		if err != nil {
+			p.logger.Error("Error purging trashed contacts", zap.Error(err))
+			return
+		}
+
+		for _, contact := range contacts {
+			if len(contact.Photo) == 0 {
+				continue
+			}
+
+			for _, key := range thumbnail.Keys(contact.Photo) {
+				if err := p.storage.Delete(key); err != nil {
+					p.logger.Error("Error deleting photo of purged contact", zap.String("key", key), zap.Error(err))
+				}
+			}
+		}
+
+		total += len(contacts)
+		if len(contacts) < p.config.BatchSize {
+			break
+		}
+	}
+
+	if total != 0 {
+		p.logger.Info("Trashed contacts have been purged", zap.Int("count", total))
+	}
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidOperation = errors.New("Error invalid batch operation has been given")
+	ErrBatchAborted     = errors.New("Error operation has been rolled back due to another failed operation")
+)
+
+// rows of a single multi-row insert, postgres accepts at most 65535 parameters
+const batchInsertSize = 1000
+
+// BatchContacts runs mixed create, update and delete operations of the user in their order, the
+// consecutive creations are inserted in bulk. Atomic batches run in a single transaction and fail
+// as a whole (returning the results along with the error) while the others report the failures
+// per operation. The invalid contacts fail with their validate.Errors.
+func (r *repository) BatchContacts(ctx context.Context, userId uint64, operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(operations))
+	for index, operation := range operations {
+		results[index] = models.BatchResult{Index: index, Op: operation.Op, Id: operation.Id}
+	}
+
+	run := func(repo *repository) error {
+		creations := make([]int, 0, len(operations))
+		flush := func() error {
+			err := repo.batchCreate(ctx, userId, operations, creations, results, atomic)
+			creations = creations[:0]
+			return err
+		}
+
+		for index, operation := range operations {
+			result := &results[index]
+
+			switch operation.Op {
+			case models.BatchCreate:
+				if operation.Contact == nil {
+					result.Err = ErrInvalidOperation
+				} else if result.Err = operation.Contact.Validate(); result.Err == nil {
+					creations = append(creations, index)
+					continue
+				}
+			case models.BatchUpdate:
+				if err := flush(); err != nil {
+					return err
+				}
+				result.Err = repo.batchUpdate(ctx, userId, operation, result)
+			case models.BatchDelete:
+				if err := flush(); err != nil {
+					return err
+				}
+				result.Err = repo.DeleteContact(ctx, userId, operation.Id, operation.Version)
+			default:
+				result.Err = ErrInvalidOperation
+			}
+
+			if result.Err != nil && atomic {
+				return result.Err
+			}
+		}
+
+		return flush()
+	}
+
+	if !atomic {
+		return results, run(r)
+	}
+
+	err := r.rdbms.WithTx(ctx, func(tx rdbms.RDBMS) error {
+		// the transaction may be retried, so the results have to be reset
+		for index := range results {
+			results[index] = models.BatchResult{Index: index, Op: operations[index].Op, Id: operations[index].Id}
+		}
+
+		return run(r.with(tx))
+	})
+
+	if err == nil {
+		r.changed(ctx, userId)
+	} else {
+		for index := range results {
+			if results[index].Err == nil {
+				results[index].Err = ErrBatchAborted
+			}
+			results[index].Id, results[index].Version = operations[index].Id, 0
+		}
+	}
+
+	return results, err
+}
+
+// with returns the repository running its queries inside of the given transaction, it doesn't
+// report the changes (see changed) as they aren't committed yet, the caller does it after the commit.
+func (r *repository) with(tx rdbms.RDBMS) *repository {
+	return &repository{logger: r.logger, config: r.config, rdbms: tx, counter: r.counter, writers: r.writers, inTx: true}
+}
+
+func (r *repository) batchUpdate(ctx context.Context, userId uint64, operation models.BatchOperation, result *models.BatchResult) error {
+	if operation.Contact == nil {
+		return ErrInvalidOperation
+	}
+
+	oldContact, err := r.GetContactById(ctx, userId, operation.Id)
+	if err != nil {
+		return err
+	}
+
+	newContact := *operation.Contact
+	newContact.Update(oldContact)
+	if err := newContact.Validate(); err != nil {
+		return err
+	}
+
+	if err := r.UpdateContact(ctx, userId, &newContact, operation.Version); err != nil {
+		return err
+	}
+
+	result.Version = newContact.Version
+	return nil
+}
+
+// batchCreate inserts the contacts of the given create operations using multi-row inserts,
+// a failing insert of a non-atomic batch is retried row by row so only the failing rows fail.
+func (r *repository) batchCreate(ctx context.Context, userId uint64, operations []models.BatchOperation, indexes []int, results []models.BatchResult, atomic bool) error {
+	for start := 0; start < len(indexes); start += batchInsertSize {
+		end := start + batchInsertSize
+		if end > len(indexes) {
+			end = len(indexes)
+		}
+		chunk := indexes[start:end]
+
+		err := r.insertContacts(ctx, userId, operations, chunk, results)
+		if err != nil && atomic {
+			err = limited(err)
+			r.logger.Error("Error inserting contacts in bulk", zap.Int("count", len(chunk)), zap.Error(err))
+			return err
+		} else if err != nil {
+			r.logger.Warn("Error inserting contacts in bulk, inserting them one by one", zap.Int("count", len(chunk)), zap.Error(err))
+			r.insertEach(ctx, userId, operations, chunk, results)
+		}
+	}
+
+	if len(indexes) != 0 {
+		r.changed(ctx, userId)
+	}
+
+	return nil
+}
+
+// insertEach inserts the contacts one by one in a transaction, each of them in its own
+// savepoint, so the failing rows are rolled back without the others.
+func (r *repository) insertEach(ctx context.Context, userId uint64, operations []models.BatchOperation, chunk []int, results []models.BatchResult) {
+	errs := make([]error, len(chunk))
+	err := r.rdbms.WithTx(ctx, func(tx rdbms.RDBMS) error {
+		for position := range chunk {
+			errs[position] = tx.WithTx(ctx, func(savepoint rdbms.RDBMS) error {
+				return r.with(savepoint).insertContacts(ctx, userId, operations, chunk[position:position+1], results)
+			})
+		}
+		return nil
+	})
+
+	for position, index := range chunk {
+		if err != nil {
+			errs[position] = err
+		}
+		if errs[position] != nil {
+			results[index].Err = limited(errs[position])
+			results[index].Id, results[index].Version = 0, 0
+			r.logger.Error("Error inserting contact of batch", zap.Int("index", index), zap.Error(results[index].Err))
+		}
+	}
+}
+
+// the ids are drawn from the sequence ahead of the insert, so every returned row is matched with its
+// ordinal in the values list instead of relying on the order of the rows, which isn't guaranteed
+const QueryBatchCreateContacts = `
+WITH input(ordinal, name, phones, description) AS (
+	VALUES {values}
+), ids AS (
+	SELECT ordinal, nextval(pg_get_serial_sequence('contacts', 'id')) AS id FROM input
+), changed AS (
+	INSERT INTO contacts(id, name, phones, description, user_id, organization_id)
+	SELECT ids.id, input.name, input.phones, input.description, $1, $2
+	FROM input JOIN ids USING (ordinal)
+	RETURNING contacts.id, contacts.version, contacts.name, contacts.phones, contacts.description
+), revision AS (
+	INSERT INTO contact_revisions(contact_id, version, operation, name, phones, description)
+	SELECT id, version, '` + string(models.OperationCreate) + `', name, phones, description FROM changed
+)
+SELECT ids.ordinal, changed.id, changed.version
+FROM changed JOIN ids USING (id);`
+
+// insertContacts inserts the contacts of the chunk by a single statement
+func (r *repository) insertContacts(ctx context.Context, userId uint64, operations []models.BatchOperation, chunk []int, results []models.BatchResult) error {
+	values := make([]string, len(chunk))
+	in := make([]any, 0, 2+4*len(chunk))
+	in = append(in, userId, organization(ctx))
+
+	for position, index := range chunk {
+		contact := operations[index].Contact
+		parameter := len(in)
+		values[position] = fmt.Sprintf("($%d::int, $%d::text, $%d::text[], $%d::text)", parameter+1, parameter+2, parameter+3, parameter+4)
+		in = append(in, position, contact.Name, pq.Array(contact.Phones), contact.Description)
+	}
+
+	// the statement differs by the size of the chunk, so it's not worth caching
+	statement := strings.Replace(QueryBatchCreateContacts, "{values}", strings.Join(values, ", "), 1)
+	return r.rdbms.Query(rdbms.Uncached(ctx), statement, in, func(row rdbms.Row) error {
+		var position int
+		var id, version uint64
+		if err := row.Scan(&position, &id, &version); err != nil {
+			return err
+		} else if position < 0 || position >= len(chunk) {
+			return fmt.Errorf("Error unexpected row of the bulk insert")
+		}
+
+		results[chunk[position]].Id, results[chunk[position]].Version = id, version
+		return nil
+	})
+}
@@ -1,9 +1,31 @@
 package repository
 
+import "time"
+
 type Config struct {
-	CursorSecret string `koanf:"cursor_secret"`
+	Driver       string        `koanf:"driver"`
+	SQLite       *SQLiteConfig `koanf:"sqlite"`
+	CursorSecret string        `koanf:"cursor_secret"`
+	CursorTTL    time.Duration `koanf:"cursor_ttl"`
+	TotalTTL     time.Duration `koanf:"total_ttl"`
+	MaxTotals    int           `koanf:"max_totals"` // maximum number of the cached totals
+	MaxTags      int           `koanf:"max_tags"`
 	Limit        struct {
 		Min int `koanf:"min"`
 		Max int `koanf:"max"`
 	} `koanf:"limit"`
+
+	// how long the latest write of every user is remembered to route their reads
+	// consistently, it can't be below the max lag of the replicas
+	WritersTTL time.Duration `koanf:"writers_ttl"`
+
+	// maximum time to wait for other instances to finish their migrations
+	MigrationLockTimeout time.Duration `koanf:"migration_lock_timeout"`
+}
+
+// SQLiteConfig configures the sqlite driver, which isn't a SQL backend of its own: it's the memory
+// backend writing every change through into a journal file and loading all of its rows into memory
+// on startup. So the data has to fit into memory and the file can't be shared by several instances.
+type SQLiteConfig struct {
+	Path string `koanf:"path"`
 }
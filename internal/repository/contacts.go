@@ -1,40 +1,62 @@
 package repository
 
 import (
-	"strconv"
+	"context"
+	"errors"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/mohammadne/phone-book/internal/models"
-	"github.com/mohammadne/phone-book/pkg/crypto"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
 	"go.uber.org/zap"
 )
 
-const QueryCreateContact = `
-INSERT INTO contacts(name, phones, description, user_id) VALUES($1, $2, $3, $4) 
-RETURNING id;`
+var (
+	ErrInvalidListing  = errors.New("Error invalid contacts listing has been given")
+	ErrVersionMismatch = errors.New("Error contact has been modified since the given version")
+)
 
-func (r *repository) CreateContact(userId uint64, contact *models.Contact) error {
-	in := []interface{}{contact.Name, pq.Array(contact.Phones), contact.Description, userId}
-	out := []any{&contact.Id}
-	if err := r.rdbms.QueryRow(QueryCreateContact, in, out); err != nil {
+var QueryCreateContact = withRevision(models.OperationCreate, `
+INSERT INTO contacts(name, phones, description, user_id, organization_id) VALUES($1, $2, $3, $4, $5)`)
+
+func (r *repository) CreateContact(ctx context.Context, userId uint64, contact *models.Contact) error {
+	in := []interface{}{contact.Name, pq.Array(contact.Phones), contact.Description, userId, organization(ctx)}
+	out := []any{&contact.Id, &contact.Version, &contact.UpdatedAt}
+	if err := r.rdbms.QueryRow(ctx, QueryCreateContact, in, out); err != nil {
 		r.logger.Error("Error inserting contact", zap.Error(err))
-		return err
+		return limited(err)
 	}
+	contact.CreatedAt = contact.UpdatedAt
+	r.changed(ctx, userId)
 	return nil
 }
 
+// tags of a contact are aggregated into an array of tag names
+const tagsColumn = `ARRAY(
+	SELECT tags.name FROM contact_tags JOIN tags ON tags.id = contact_tags.tag_id 
+	WHERE contact_tags.contact_id = contacts.id ORDER BY tags.name
+)`
+
 const QueryGetContactById = `
-SELECT name, phones, description
+SELECT name, phones, description, favorite, usage_count, last_used_at, COALESCE(photo, ''), version, created_at, updated_at, ` + tagsColumn + `
 FROM contacts
-WHERE user_id=$1 AND id=$2;`
+WHERE user_id=$1 AND id=$2 AND organization_id=$3 AND deleted_at IS NULL;`
+
+func (r *repository) GetContactById(ctx context.Context, userId, contactId uint64) (*models.Contact, error) {
+	return r.getContactById(ctx, r.reader(ctx, userId), userId, contactId)
+}
 
-func (r *repository) GetContactById(userId, contactId uint64) (*models.Contact, error) {
+func (r *repository) getContactById(ctx context.Context, db rdbms.RDBMS, userId, contactId uint64) (*models.Contact, error) {
 	contact := models.Contact{Id: contactId}
 
-	in := []any{userId, contactId}
-	out := []any{&contact.Name, pq.Array(&contact.Phones), &contact.Description}
-	if err := r.rdbms.QueryRow(QueryGetContactById, in, out); err != nil {
+	in := []any{userId, contactId, organization(ctx)}
+	out := []any{
+		&contact.Name, pq.Array(&contact.Phones), &contact.Description,
+		&contact.Favorite, &contact.UsageCount, &contact.LastUsedAt, &contact.Photo, &contact.Version,
+		&contact.CreatedAt, &contact.UpdatedAt, pq.Array(&contact.Tags),
+	}
+	if err := db.QueryRow(ctx, QueryGetContactById, in, out); err != nil {
 		r.logger.Error("Error get contact by id", zap.Error(err))
 		return nil, err
 	}
@@ -42,109 +64,378 @@ func (r *repository) GetContactById(userId, contactId uint64) (*models.Contact,
 	return &contact, nil
 }
 
-const QueryUpdateContact = `
+var QueryUpdateContact = withRevision(models.OperationUpdate, `
 UPDATE contacts 
-SET name=$1, phones=$2, description=$3 
-WHERE user_id=$4 AND id=$5;`
+SET name=$1, phones=$2, description=$3, version=version+1 
+WHERE user_id=$4 AND id=$5 AND organization_id=$7 AND deleted_at IS NULL AND ($6 = 0 OR version=$6)`)
 
-func (r *repository) UpdateContact(userId uint64, contact *models.Contact) error {
-	in := []any{contact.Name, pq.Array(contact.Phones), contact.Description, userId, contact.Id}
-	if err := r.rdbms.Execute(QueryUpdateContact, in); err != nil {
+// UpdateContact updates the contact only if it's still in the given version (zero means any version)
+func (r *repository) UpdateContact(ctx context.Context, userId uint64, contact *models.Contact, version uint64) error {
+	in := []any{contact.Name, pq.Array(contact.Phones), contact.Description, userId, contact.Id, version, organization(ctx)}
+	out := []any{&contact.Id, &contact.Version, &contact.UpdatedAt}
+	if err := r.rdbms.QueryRow(ctx, QueryUpdateContact, in, out); err != nil {
+		err = r.versionMismatch(ctx, userId, contact.Id, version, err)
 		r.logger.Error("Error updating contact", zap.Error(err))
 		return err
 	}
+	r.changed(ctx, userId)
 	return nil
 }
 
-const QueryDeleteContact = `
-DELETE FROM contacts 
-WHERE user_id=$1 AND id=$2;`
+// contacts are moved into the trash, they will be purged after the retention
+var QueryDeleteContact = withRevision(models.OperationDelete, `
+UPDATE contacts 
+SET deleted_at=CURRENT_TIMESTAMP, version=version+1 
+WHERE user_id=$1 AND id=$2 AND organization_id=$4 AND deleted_at IS NULL AND ($3 = 0 OR version=$3)`)
 
-func (r *repository) DeleteContact(userId, contactId uint64) error {
-	in := []interface{}{userId, contactId}
-	if err := r.rdbms.Execute(QueryDeleteContact, in); err != nil {
+// DeleteContact deletes the contact only if it's still in the given version (zero means any version)
+func (r *repository) DeleteContact(ctx context.Context, userId, contactId, version uint64) error {
+	var newVersion uint64
+	in := []interface{}{userId, contactId, version, organization(ctx)}
+	out := []any{&contactId, &newVersion, new(time.Time)}
+	if err := r.rdbms.QueryRow(ctx, QueryDeleteContact, in, out); err != nil {
+		err = r.versionMismatch(ctx, userId, contactId, version, err)
 		r.logger.Error("Error deleting contact", zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
 		return err
 	}
+	r.changed(ctx, userId)
 	return nil
 }
 
+// versionMismatch tells apart a missing contact from a contact which has been
+// modified concurrently, when the conditional change has not affected any row.
+func (r *repository) versionMismatch(ctx context.Context, userId, contactId, version uint64, err error) error {
+	if version == 0 || !errors.Is(err, rdbms.ErrNotFound) {
+		return err
+	}
+
+	// the replicas may not have the latest version yet
+	if _, getErr := r.getContactById(ctx, r.rdbms, userId, contactId); getErr == nil {
+		return ErrVersionMismatch
+	}
+	return err
+}
+
+// listings defines how each kind of contact listing is filtered and ordered.
+//
+// the keyset of every listing is (key, id) and key is a BIGINT expression,
+// so all of them can share the same cursor and the same query template.
+type listing struct {
+	filter     string
+	key        string
+	descending bool
+}
+
+var listings = map[models.Listing]listing{
+	models.ListingAll:       {filter: "deleted_at IS NULL", key: "id"},
+	models.ListingFavorites: {filter: "deleted_at IS NULL AND favorite", key: "id"},
+	models.ListingRecent: {
+		filter:     "deleted_at IS NULL AND last_used_at IS NOT NULL",
+		key:        "(EXTRACT(EPOCH FROM last_used_at) * 1000000)::BIGINT",
+		descending: true,
+	},
+	models.ListingTrash: {
+		filter:     "deleted_at IS NOT NULL",
+		key:        "(EXTRACT(EPOCH FROM deleted_at) * 1000000)::BIGINT",
+		descending: true,
+	},
+}
+
+const contactColumns = `id, name, phones, description, favorite, usage_count, last_used_at, COALESCE(photo, ''), deleted_at, version, created_at, updated_at, ` + tagsColumn
+
+const contactsFilter = `
+	user_id=$1 AND 
+	organization_id=$2 AND 
+	name LIKE '%' || $3 || '%' AND 
+	($4 = '' OR EXISTS (
+		SELECT 1 FROM contact_tags JOIN tags ON tags.id = contact_tags.tag_id 
+		WHERE contact_tags.contact_id = contacts.id AND tags.name = $4
+	))`
+
+// QueryGetContacts placeholders are filled with the listing's key, filter,
+// the keyset comparison operator and the sort order
 const QueryGetContacts = `
-SELECT id, name, phones, description
+SELECT ` + contactColumns + `, {key}
 FROM contacts
-WHERE 
-	user_id=$1 AND 
-	id > $2 AND 
-	name LIKE '%' || $3 || '%'
-ORDER BY id
-FETCH NEXT $4 ROWS ONLY;`
+WHERE ` + contactsFilter + ` AND 
+	{filter} AND 
+	($5 OR ({key}, id) {operator} ($6, $7))
+ORDER BY {key} {order}, id {order}
+FETCH NEXT $8 ROWS ONLY;`
 
-func (r *repository) GetContacts(userId uint64, encryptedCursor, search string, limit int) ([]models.Contact, string, error) {
-	var id uint64 = 0
+const QueryCountContacts = `
+SELECT COUNT(*)
+FROM contacts
+WHERE ` + contactsFilter + ` AND 
+	{filter};`
+
+// listingQuery is a normalized contact listing query along with its decoded cursor
+type listingQuery struct {
+	listing
+	limit       int
+	cursor      *cursor
+	fingerprint string
+}
 
-	if limit < r.config.Limit.Min {
-		limit = r.config.Limit.Min
-	} else if limit > r.config.Limit.Max {
-		limit = r.config.Limit.Max
+func prepareListing(cfg *Config, query *models.ContactsQuery) (*listingQuery, error) {
+	var lq = &listingQuery{limit: query.Limit, cursor: &cursor{Direction: forward}}
+
+	if lq.limit < cfg.Limit.Min {
+		lq.limit = cfg.Limit.Min
+	} else if lq.limit > cfg.Limit.Max {
+		lq.limit = cfg.Limit.Max
+	}
+
+	if len(query.Listing) == 0 {
+		query.Listing = models.ListingAll
+	}
+
+	var ok bool
+	if lq.listing, ok = listings[query.Listing]; !ok {
+		return nil, ErrInvalidListing
 	}
 
 	// decrypt cursor
-	if len(encryptedCursor) != 0 {
-		cursor, err := crypto.Decrypt(encryptedCursor, r.config.CursorSecret)
-		if err != nil {
-			panic(err)
+	lq.fingerprint = fingerprint(string(query.Listing), query.Search, query.Tag)
+	if len(query.Cursor) != 0 {
+		var err error
+		if lq.cursor, err = decodeCursor(cfg, query.Cursor, lq.fingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	return lq, nil
+}
+
+// reversed tells whether the rows are fetched in the reverse order of the listing,
+// as moving backward is the same as moving forward in the reverse order.
+func (lq *listingQuery) reversed() bool {
+	return lq.descending != (lq.cursor.Direction == backward)
+}
+
+// page builds the page out of the fetched rows (at most limit+1 of them, in the fetch order)
+// and their keys, the extra row tells whether there's another page in the direction.
+func (lq *listingQuery) page(cfg *Config, query *models.ContactsQuery, contacts []models.Contact, keys []int64) (*models.ContactsPage, error) {
+	hasExtra := len(contacts) > lq.limit
+	if hasExtra {
+		contacts, keys = contacts[:lq.limit], keys[:lq.limit]
+	}
+
+	// moving backward the rows are fetched in the reverse order
+	if lq.cursor.Direction == backward {
+		for i, j := 0, len(contacts)-1; i < j; i, j = i+1, j-1 {
+			contacts[i], contacts[j] = contacts[j], contacts[i]
+			keys[i], keys[j] = keys[j], keys[i]
 		}
+	}
+
+	page := &models.ContactsPage{Contacts: contacts}
 
-		splits := strings.Split(cursor, ",")
-		if len(splits) != 1 {
-			panic("err")
+	if len(contacts) != 0 {
+		// going forward there are previous rows whenever a cursor is given,
+		// going backward the rows after the cursor are the one we came from.
+		hasNext, hasPrev := hasExtra, len(query.Cursor) != 0
+		if lq.cursor.Direction == backward {
+			hasNext, hasPrev = true, hasExtra
 		}
 
-		id, err = strconv.ParseUint(splits[0], 10, 64)
-		if err != nil {
-			panic(err)
+		// encrypt cursors
+		var err error
+		if hasNext {
+			last := len(contacts) - 1
+			next := &cursor{Fingerprint: lq.fingerprint, Direction: forward, Key: keys[last], Id: contacts[last].Id}
+			if page.Next, err = encodeCursor(cfg, next); err != nil {
+				return nil, err
+			}
+		}
+
+		if hasPrev {
+			prev := &cursor{Fingerprint: lq.fingerprint, Direction: backward, Key: keys[0], Id: contacts[0].Id}
+			if page.Prev, err = encodeCursor(cfg, prev); err != nil {
+				return nil, err
+			}
 		}
+
+		page.HasMore = hasNext
 	}
 
-	contacts := make([]models.Contact, limit)
-	out := make([][]any, limit)
+	return page, nil
+}
 
-	for index := 0; index < limit; index++ {
-		out[index] = []any{&contacts[index].Id, &contacts[index].Name, pq.Array(&contacts[index].Phones), &contacts[index].Description}
+func (r *repository) GetContacts(ctx context.Context, userId uint64, query *models.ContactsQuery) (*models.ContactsPage, error) {
+	lq, err := prepareListing(r.config, query)
+	if err != nil {
+		return nil, err
 	}
 
-	in := []any{userId, id, search, limit}
-	if err := r.rdbms.Query(QueryGetContacts, in, out); err != nil {
-		r.logger.Error("Error query contacts", zap.Error(err))
-		return nil, "", err
+	operator, order := ">", "ASC"
+	if lq.reversed() {
+		operator, order = "<", "DESC"
 	}
+	statement := strings.NewReplacer(
+		"{key}", lq.key, "{filter}", lq.filter, "{operator}", operator, "{order}", order,
+	).Replace(QueryGetContacts)
+
+	// fetch one extra row to find out whether there's another page in the direction
+	contacts := make([]models.Contact, 0, lq.limit+1)
+	keys := make([]int64, 0, lq.limit+1)
 
-	if len(contacts) == 0 {
-		return contacts, "", nil
+	in := []any{userId, organization(ctx), query.Search, query.Tag, len(query.Cursor) == 0, lq.cursor.Key, lq.cursor.Id, lq.limit + 1}
+	err = r.reader(ctx, userId).Query(ctx, statement, in, func(row rdbms.Row) error {
+		var contact models.Contact
+		var key int64
+		err := row.Scan(
+			&contact.Id, &contact.Name, pq.Array(&contact.Phones), &contact.Description,
+			&contact.Favorite, &contact.UsageCount, &contact.LastUsedAt, &contact.Photo, &contact.DeletedAt,
+			&contact.Version, &contact.CreatedAt, &contact.UpdatedAt, pq.Array(&contact.Tags), &key,
+		)
+		contacts, keys = append(contacts, contact), append(keys, key)
+		return err
+	})
+	if err != nil {
+		r.logger.Error("Error query contacts", zap.Error(err))
+		return nil, err
 	}
 
-	var lastContact models.Contact
+	page, err := lq.page(r.config, query, contacts, keys)
+	if err != nil {
+		r.logger.Error("Error encrypting cursor", zap.Error(err))
+		return nil, err
+	}
 
-	for index := limit - 1; index >= 0; index-- {
-		if contacts[index].Id != 0 {
-			lastContact = contacts[index]
-			break
-		} else {
-			contacts = contacts[:index]
+	if query.Total {
+		total, err := r.countContacts(ctx, userId, query)
+		if err != nil {
+			return nil, err
 		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+func (r *repository) countContacts(ctx context.Context, userId uint64, query *models.ContactsQuery) (int, error) {
+	key := string(query.Listing) + "\x00" + query.Search + "\x00" + query.Tag
+	if total, ok := r.counter.get(userId, key); ok {
+		return total, nil
+	}
+
+	var total int
+	statement := strings.ReplaceAll(QueryCountContacts, "{filter}", listings[query.Listing].filter)
+	in := []any{userId, organization(ctx), query.Search, query.Tag}
+	out := []any{&total}
+	if err := r.reader(ctx, userId).QueryRow(ctx, statement, in, out); err != nil {
+		r.logger.Error("Error counting contacts", zap.Uint64("user-id", userId), zap.Error(err))
+		return 0, err
+	}
+
+	r.counter.set(userId, key, total)
+	return total, nil
+}
+
+// the favorite, the usage statistics and the photo aren't the content of the contact, so they
+// don't bump its version which would fail the If-Match of every client editing the contact
+const QuerySetContactFavorite = `
+UPDATE contacts 
+SET favorite=$1
+WHERE user_id=$2 AND id=$3 AND organization_id=$4 AND deleted_at IS NULL
+RETURNING id;`
+
+func (r *repository) SetContactFavorite(ctx context.Context, userId, contactId uint64, favorite bool) error {
+	in := []any{favorite, userId, contactId, organization(ctx)}
+	out := []any{&contactId}
+	if err := r.rdbms.QueryRow(ctx, QuerySetContactFavorite, in, out); err != nil {
+		r.logger.Error("Error setting contact favorite", zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+const QueryUseContact = `
+UPDATE contacts 
+SET usage_count=usage_count+1, last_used_at=CURRENT_TIMESTAMP
+WHERE user_id=$1 AND id=$2 AND organization_id=$3 AND deleted_at IS NULL
+RETURNING id;`
+
+func (r *repository) UseContact(ctx context.Context, userId, contactId uint64) error {
+	in := []any{userId, contactId, organization(ctx)}
+	out := []any{&contactId}
+	if err := r.rdbms.QueryRow(ctx, QueryUseContact, in, out); err != nil {
+		r.logger.Error("Error marking contact as used", zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return err
 	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+const QuerySetContactPhoto = `
+UPDATE contacts 
+SET photo=NULLIF($1, '')
+WHERE user_id=$2 AND id=$3 AND organization_id=$4 AND deleted_at IS NULL
+RETURNING id;`
+
+// SetContactPhoto sets the storage key prefix of the contact photo, an empty one removes it
+func (r *repository) SetContactPhoto(ctx context.Context, userId, contactId uint64, photo string) error {
+	in := []any{photo, userId, contactId, organization(ctx)}
+	out := []any{&contactId}
+	if err := r.rdbms.QueryRow(ctx, QuerySetContactPhoto, in, out); err != nil {
+		r.logger.Error("Error setting contact photo", zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return err
+	}
+	r.writers.wrote(ctx, userId)
+	return nil
+}
+
+var QueryRestoreContact = withRevision(models.OperationRestore, `
+UPDATE contacts 
+SET deleted_at=NULL, version=version+1 
+WHERE user_id=$1 AND id=$2 AND organization_id=$3 AND deleted_at IS NOT NULL`)
 
-	if lastContact.Id == 0 {
-		return contacts, "", nil
+func (r *repository) RestoreContact(ctx context.Context, userId, contactId uint64) error {
+	var version uint64
+	in := []any{userId, contactId, organization(ctx)}
+	out := []any{&contactId, &version, new(time.Time)}
+	if err := r.rdbms.QueryRow(ctx, QueryRestoreContact, in, out); err != nil {
+		r.logger.Error("Error restoring contact", zap.Uint64("user-id", userId), zap.Uint64("contact-id", contactId), zap.Error(err))
+		return err
 	}
+	r.changed(ctx, userId)
+	return nil
+}
 
-	cursor := strconv.FormatUint(lastContact.Id, 10)
+const QueryPurgeContacts = `
+DELETE FROM contacts 
+WHERE id IN (
+	SELECT id FROM contacts 
+	WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1) 
+	FETCH NEXT $2 ROWS ONLY
+)
+RETURNING id, user_id, COALESCE(photo, '');`
+
+// PurgeContacts permanently removes at most limit contacts which have been in the trash
+// for longer than the retention, the purged contacts are returned with their photo.
+// It's a background job of all the organizations, so it isn't scoped.
+func (r *repository) PurgeContacts(ctx context.Context, retention time.Duration, limit int) ([]models.Contact, error) {
+	contacts := []models.Contact{}
+	userIds := []uint64{}
 
-	// encrypt cursor
-	encryptedCursor, err := crypto.Encrypt(cursor, r.config.CursorSecret)
+	in := []any{retention.Seconds(), limit}
+	err := r.rdbms.Query(ctx, QueryPurgeContacts, in, func(row rdbms.Row) error {
+		var contact models.Contact
+		var userId uint64
+		err := row.Scan(&contact.Id, &userId, &contact.Photo)
+		contacts, userIds = append(contacts, contact), append(userIds, userId)
+		return err
+	})
 	if err != nil {
-		panic(err)
+		r.logger.Error("Error purging contacts", zap.Error(err))
+		return nil, err
+	}
+
+	for _, userId := range userIds {
+		r.changed(ctx, userId)
 	}
 
-	return contacts, encryptedCursor, nil
+	return contacts, nil
 }
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// counter caches the total number of contacts matching a listing query,
+// counting the whole result set on every page request is too expensive.
+// The queries are given by the clients, so the number of the totals is bounded
+// and the oldest ones are dropped first.
+type counter struct {
+	ttl     time.Duration
+	size    int // maximum number of the totals of all users
+	mutex   sync.RWMutex
+	entries map[uint64]map[string]*list.Element
+	order   *list.List // most recently set at the front, so the first to expire are at the back
+}
+
+type counterEntry struct {
+	userId    uint64
+	key       string
+	total     int
+	expiresAt time.Time
+}
+
+func newCounter(ttl time.Duration, size int) *counter {
+	return &counter{ttl: ttl, size: size, entries: make(map[uint64]map[string]*list.Element), order: list.New()}
+}
+
+func (c *counter) get(userId uint64, key string) (int, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	element, ok := c.entries[userId][key]
+	if !ok {
+		return 0, false
+	}
+
+	entry := element.Value.(*counterEntry)
+	if time.Now().After(entry.expiresAt) {
+		return 0, false
+	}
+	return entry.total, true
+}
+
+func (c *counter) set(userId uint64, key string, total int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[userId][key]; ok {
+		c.remove(element)
+	}
+
+	now := time.Now()
+	if _, ok := c.entries[userId]; !ok {
+		c.entries[userId] = make(map[string]*list.Element)
+	}
+	c.entries[userId][key] = c.order.PushFront(&counterEntry{userId: userId, key: key, total: total, expiresAt: now.Add(c.ttl)})
+
+	// every total lives as long as the ttl, so sweeping the expired ones only looks at the back
+	for back := c.order.Back(); back != nil; back = c.order.Back() {
+		if c.order.Len() <= c.size && now.Before(back.Value.(*counterEntry).expiresAt) {
+			break
+		}
+		c.remove(back)
+	}
+}
+
+// invalidate drops every cached total of the user, it should be called
+// whenever the set of user's contacts changes.
+func (c *counter) invalidate(userId uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, element := range c.entries[userId] {
+		c.remove(element)
+	}
+}
+
+// remove must be called while holding the lock
+func (c *counter) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*counterEntry)
+	delete(c.entries[entry.userId], entry.key)
+	if len(c.entries[entry.userId]) == 0 {
+		delete(c.entries, entry.userId)
+	}
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mohammadne/phone-book/pkg/crypto"
+)
+
+var ErrInvalidCursor = errors.New("Error invalid or expired cursor has been given")
+
+// cursorVersion is bumped on every change of the cursor content, so the cursors issued
+// before it are rejected rather than decoded into zero fields (2 added direction and key)
+const cursorVersion = 2
+
+type direction string
+
+const (
+	forward  direction = "next"
+	backward direction = "prev"
+)
+
+// cursor is the plain content of a pagination cursor, it's sealed with
+// AES-GCM before handing it to the client so it can't be forged or altered.
+type cursor struct {
+	Version     int       `json:"v"`
+	Fingerprint string    `json:"f"`
+	Direction   direction `json:"d"`
+	Key         int64     `json:"k,omitempty"`
+	Id          uint64    `json:"id"`
+	ExpiresAt   int64     `json:"exp"`
+}
+
+// fingerprint binds a cursor to the filters and sorting of the query it was
+// issued for, so a cursor can't be replayed against a different listing.
+func fingerprint(sort string, filters ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(sort))
+	for _, filter := range filters {
+		hash.Write([]byte{0})
+		hash.Write([]byte(filter))
+	}
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:12])
+}
+
+func encodeCursor(cfg *Config, c *cursor) (string, error) {
+	c.Version = cursorVersion
+	c.ExpiresAt = time.Now().Add(cfg.CursorTTL).Unix()
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.Encrypt(string(data), cfg.CursorSecret)
+}
+
+func decodeCursor(cfg *Config, encryptedCursor, fingerprint string) (*cursor, error) {
+	data, err := crypto.Decrypt(encryptedCursor, cfg.CursorSecret)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &cursor{}
+	if err := json.Unmarshal([]byte(data), c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Version != cursorVersion || c.Fingerprint != fingerprint || time.Now().Unix() > c.ExpiresAt {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Direction != forward && c.Direction != backward {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mohammadne/phone-book/pkg/crypto"
+)
+
+func TestCursor(t *testing.T) {
+	cfg := testConfig(DriverMemory, "")
+	listing := fingerprint("name", "tag")
+
+	encoded, err := encodeCursor(cfg, &cursor{Fingerprint: listing, Direction: backward, Key: 7, Id: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeCursor(cfg, encoded, listing)
+	if err != nil {
+		t.Fatal(err)
+	} else if decoded.Direction != backward || decoded.Key != 7 || decoded.Id != 42 {
+		t.Fatalf("cursor has been decoded into %+v", decoded)
+	}
+
+	if _, err := decodeCursor(cfg, encoded, fingerprint("name", "other")); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("cursor of another listing has returned %v", err)
+	} else if _, err := decodeCursor(cfg, encoded[1:], listing); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("altered cursor has returned %v", err)
+	}
+}
+
+// TestCursorVersion checks the cursors of the older versions are rejected
+func TestCursorVersion(t *testing.T) {
+	cfg := testConfig(DriverMemory, "")
+	listing := fingerprint("name")
+
+	// the content of the first version, without direction and key
+	data, _ := json.Marshal(map[string]any{"v": 1, "f": listing, "id": 42, "exp": time.Now().Add(time.Hour).Unix()})
+	encoded, err := crypto.Encrypt(string(data), cfg.CursorSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decodeCursor(cfg, encoded, listing); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("cursor of the first version has returned %v instead of %v", err, ErrInvalidCursor)
+	}
+}
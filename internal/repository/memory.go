@@ -0,0 +1,1008 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+// tables of the memory state, they're also the tables of the journal
+const (
+	tableOrganizations = "organizations"
+	tableUsers         = "users"
+	tableContacts      = "contacts"
+	tableTags          = "tags"
+	tableContactTags   = "contact_tags"
+	tableRevisions     = "contact_revisions"
+	tableSequences     = "sequences"
+)
+
+type memoryContact struct {
+	UserId uint64
+	models.Contact
+}
+
+type memoryTag struct {
+	UserId uint64
+	models.Tag
+}
+
+type memoryRevision struct {
+	ContactId uint64
+	models.Revision
+}
+
+// memoryState holds all of the rows, they are never modified in place
+// (a changed row is replaced by a new one) so they can be shared with the callers.
+type memoryState struct {
+	organizations map[uint64]*models.Organization
+	users         map[uint64]*models.User
+	contacts      map[uint64]*memoryContact
+	tags          map[uint64]*memoryTag
+	contactTags   map[uint64]map[uint64]bool // tag ids of every contact
+	revisions     map[uint64]*memoryRevision
+	sequences     map[string]uint64
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		organizations: make(map[uint64]*models.Organization),
+		users:         make(map[uint64]*models.User),
+		contacts:      make(map[uint64]*memoryContact),
+		tags:          make(map[uint64]*memoryTag),
+		contactTags:   make(map[uint64]map[uint64]bool),
+		revisions:     make(map[uint64]*memoryRevision),
+		sequences:     make(map[string]uint64),
+	}
+}
+
+// change is a single row written into (or deleted from, if the row is nil) a table,
+// the key of contact tags is the pair of contact and tag ids.
+type change struct {
+	table string
+	key   any
+	row   any
+}
+
+// journal durably records the changes before they're visible, see the SQLite backend
+type journal interface {
+	write(ctx context.Context, changes []change) error
+	close() error
+}
+
+// memory is a Repository keeping all of the data in the process memory, it's meant for
+// tests and demos. All the calls are serialized and every change can be undone, so the
+// failed calls (and atomic batches) leave nothing behind.
+type memory struct {
+	logger  *zap.Logger
+	config  *Config
+	mutex   sync.RWMutex
+	state   *memoryState
+	journal journal // nil keeps the changes in memory only
+}
+
+func NewMemory(logger *zap.Logger, cfg *Config) Repository {
+	state := newMemoryState()
+
+	// the counterpart of the default organization of the postgres backend
+	state.organizations[1] = &models.Organization{Id: 1, Slug: "default", Name: "Default", CreatedAt: time.Now().UTC()}
+	state.sequences[tableOrganizations] = 1
+
+	return &memory{logger: logger, config: cfg, state: state}
+}
+
+func (m *memory) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.journal == nil {
+		return nil
+	}
+	return m.journal.close()
+}
+
+// memoryTx is the state as seen by a call of the organization, it records the changes
+// and how to undo them while the call modifies the state.
+type memoryTx struct {
+	*memoryState
+	org     uint64
+	now     time.Time
+	changes []change
+	undo    []func()
+}
+
+func (m *memory) view(ctx context.Context, fn func(s *memoryTx) error) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(&memoryTx{memoryState: m.state, org: organization(ctx)})
+}
+
+// update runs the function with exclusive access to the state, its changes are written into
+// the journal (if any) and they are undone if either the function or the journal fails.
+func (m *memory) update(ctx context.Context, fn func(tx *memoryTx) error) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := &memoryTx{memoryState: m.state, org: organization(ctx), now: time.Now().UTC()}
+	err := fn(tx)
+	if err == nil && m.journal != nil && len(tx.changes) != 0 {
+		err = m.journal.write(ctx, tx.changes)
+	}
+
+	if err != nil {
+		tx.rollback(0)
+		return err
+	}
+	return nil
+}
+
+// mark returns a savepoint of the transaction, see rollback
+func (tx *memoryTx) mark() int {
+	return len(tx.undo)
+}
+
+// rollback undoes the changes made after the savepoint
+func (tx *memoryTx) rollback(mark int) {
+	for index := len(tx.undo) - 1; index >= mark; index-- {
+		tx.undo[index]()
+	}
+	tx.undo, tx.changes = tx.undo[:mark], tx.changes[:mark]
+}
+
+func setRow[K comparable, V any](tx *memoryTx, table string, rows map[K]V, key K, row V, exists bool) {
+	old, had := rows[key]
+	tx.undo = append(tx.undo, func() {
+		if had {
+			rows[key] = old
+		} else {
+			delete(rows, key)
+		}
+	})
+
+	var value any
+	if exists {
+		rows[key], value = row, row
+	} else {
+		delete(rows, key)
+	}
+	tx.changes = append(tx.changes, change{table: table, key: key, row: value})
+}
+
+func (tx *memoryTx) next(sequence string) uint64 {
+	value := tx.sequences[sequence] + 1
+	setRow(tx, tableSequences, tx.sequences, sequence, value, true)
+	return value
+}
+
+func (tx *memoryTx) putOrganization(org *models.Organization) {
+	setRow(tx, tableOrganizations, tx.organizations, org.Id, org, true)
+}
+
+func (tx *memoryTx) putUser(user *models.User) {
+	setRow(tx, tableUsers, tx.users, user.Id, user, true)
+}
+
+func (tx *memoryTx) putContact(contact *memoryContact) {
+	setRow(tx, tableContacts, tx.contacts, contact.Id, contact, true)
+}
+
+func (tx *memoryTx) putTag(tag *memoryTag) {
+	setRow(tx, tableTags, tx.tags, tag.Id, tag, true)
+}
+
+func (tx *memoryTx) putRevision(revision *memoryRevision) {
+	setRow(tx, tableRevisions, tx.revisions, revision.Id, revision, true)
+}
+
+// setContactTag tags (or untags) the contact, it reports whether anything has changed
+func (tx *memoryTx) setContactTag(contactId, tagId uint64, tagged bool) bool {
+	if tx.contactTags[contactId][tagId] == tagged {
+		return false
+	}
+
+	if tx.contactTags[contactId] == nil {
+		tx.contactTags[contactId] = make(map[uint64]bool)
+	}
+	setRow(tx, tableContactTags, tx.contactTags[contactId], tagId, true, tagged)
+
+	// the key of the journal is the pair, not only the tag id
+	tx.changes[len(tx.changes)-1].key = [2]uint64{contactId, tagId}
+	return true
+}
+
+// count changes the usage counters of the organization, exceeding its limits fails
+func (tx *memoryTx) count(orgId uint64, users, contacts int) error {
+	old, ok := tx.organizations[orgId]
+	if !ok {
+		return rdbms.ErrForeignKey
+	}
+
+	org := *old
+	org.UsersCount, org.ContactsCount = org.UsersCount+users, org.ContactsCount+contacts
+	if users > 0 && org.MaxUsers != nil && org.UsersCount > *org.MaxUsers {
+		return ErrUsersLimitExceeded
+	} else if contacts > 0 && org.MaxContacts != nil && org.ContactsCount > *org.MaxContacts {
+		return ErrContactsLimitExceeded
+	}
+
+	tx.putOrganization(&org)
+	return nil
+}
+
+// member tells whether the user belongs to the organization of the call
+func (tx *memoryTx) member(userId uint64) bool {
+	user, ok := tx.users[userId]
+	return ok && user.OrganizationId == tx.org
+}
+
+// removeContact permanently removes the contact along with its tags and revisions
+func (tx *memoryTx) removeContact(contact *memoryContact) {
+	tx.count(tx.users[contact.UserId].OrganizationId, 0, -1)
+
+	for tagId := range tx.contactTags[contact.Id] {
+		tx.setContactTag(contact.Id, tagId, false)
+	}
+
+	for id, revision := range tx.revisions {
+		if revision.ContactId == contact.Id {
+			setRow(tx, tableRevisions, tx.revisions, id, nil, false)
+		}
+	}
+
+	setRow(tx, tableContacts, tx.contacts, contact.Id, nil, false)
+}
+
+// revise appends the current state of the contact to its revisions
+func (tx *memoryTx) revise(contact *memoryContact, operation models.Operation) {
+	tx.putRevision(&memoryRevision{
+		ContactId: contact.Id,
+		Revision: models.Revision{
+			Id:          tx.next(tableRevisions),
+			Version:     contact.Version,
+			Operation:   operation,
+			Name:        contact.Name,
+			Phones:      contact.Phones,
+			Description: contact.Description,
+			CreatedAt:   tx.now,
+		},
+	})
+}
+
+// contact returns the contact of the user, either a live or a trashed one
+func (tx *memoryTx) contact(userId, contactId uint64, trashed bool) (*memoryContact, bool) {
+	contact, ok := tx.contacts[contactId]
+	if !ok || contact.UserId != userId || !tx.member(userId) || (contact.DeletedAt != nil) != trashed {
+		return nil, false
+	}
+	return contact, true
+}
+
+// output returns a copy of the contact along with its tags
+func (s *memoryState) output(contact *memoryContact) models.Contact {
+	result := contact.Contact
+	result.Tags = []string{}
+	for tagId := range s.contactTags[contact.Id] {
+		result.Tags = append(result.Tags, s.tags[tagId].Name)
+	}
+	sort.Strings(result.Tags)
+	return result
+}
+
+// change replaces the live contact of the user by a changed copy, the version is
+// incremented and the update time is set unless only the usage statistics change.
+// contactChange is the kind of a change of a contact, only the changes of its content bump the version
+type contactChange int
+
+const (
+	changeContent   contactChange = iota // bumps the version and updated_at
+	changeAttribute                      // the favorite and the photo, only bumps updated_at
+	changeUsage                          // the usage statistics, bumps neither of them
+)
+
+func (tx *memoryTx) change(userId, contactId, version uint64, fn func(contact *memoryContact) contactChange) (*memoryContact, error) {
+	old, ok := tx.contact(userId, contactId, false)
+	if !ok {
+		return nil, rdbms.ErrNotFound
+	} else if version != 0 && old.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	contact := *old
+	switch fn(&contact) {
+	case changeContent:
+		contact.Version++
+		contact.UpdatedAt = tx.now
+	case changeAttribute:
+		contact.UpdatedAt = tx.now
+	}
+	tx.putContact(&contact)
+	return &contact, nil
+}
+
+func (m *memory) Migrate(ctx context.Context, direction models.Migrate, steps int) error {
+	return nil
+}
+
+func (m *memory) MigrateTo(ctx context.Context, version uint64) error {
+	return nil
+}
+
+// Migrations returns nothing, the state of memory backend has no schema to migrate
+func (m *memory) Migrations(ctx context.Context) ([]models.Migration, error) {
+	return []models.Migration{}, nil
+}
+
+func (m *memory) PlanMigrate(ctx context.Context, direction models.Migrate, steps int) ([]models.MigrationStep, error) {
+	return []models.MigrationStep{}, nil
+}
+
+func (m *memory) PlanMigrateTo(ctx context.Context, version uint64) ([]models.MigrationStep, error) {
+	return []models.MigrationStep{}, nil
+}
+
+func (m *memory) CreateUser(ctx context.Context, user *models.User) error {
+	if len(user.Email) == 0 || len(user.Password) == 0 {
+		return errors.New("Insufficient information for user")
+	}
+
+	return m.update(ctx, func(tx *memoryTx) error {
+		for _, other := range tx.users {
+			if other.OrganizationId == tx.org && strings.EqualFold(other.Email, user.Email) {
+				return rdbms.ErrDuplicate
+			}
+		}
+
+		if err := tx.count(tx.org, 1, 0); err != nil {
+			return err
+		}
+
+		row := &models.User{OrganizationId: tx.org, Email: user.Email, Password: user.Password, CreatedAt: tx.now.Format(time.RFC3339Nano)}
+		row.Id = tx.next(tableUsers)
+		tx.putUser(row)
+
+		user.Id, user.OrganizationId, user.CreatedAt = row.Id, row.OrganizationId, row.CreatedAt
+		return nil
+	})
+}
+
+func (m *memory) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return m.findUser(ctx, email, func(user *models.User) bool { return true })
+}
+
+func (m *memory) GetUserByEmailAndPassword(ctx context.Context, email, password string) (*models.User, error) {
+	return m.findUser(ctx, email, func(user *models.User) bool { return user.Password == password })
+}
+
+func (m *memory) findUser(ctx context.Context, email string, match func(user *models.User) bool) (*models.User, error) {
+	var result *models.User
+	err := m.view(ctx, func(s *memoryTx) error {
+		for _, user := range s.users {
+			if user.OrganizationId == s.org && strings.EqualFold(user.Email, email) && match(user) {
+				copied := *user
+				result = &copied
+				return nil
+			}
+		}
+		return rdbms.ErrNotFound
+	})
+	return result, err
+}
+
+func (m *memory) CreateContact(ctx context.Context, userId uint64, contact *models.Contact) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		return tx.createContact(userId, contact)
+	})
+}
+
+func (tx *memoryTx) createContact(userId uint64, contact *models.Contact) error {
+	if !tx.member(userId) {
+		return rdbms.ErrForeignKey
+	} else if err := tx.count(tx.org, 0, 1); err != nil {
+		return err
+	}
+
+	row := &memoryContact{UserId: userId, Contact: models.Contact{
+		Id:          tx.next(tableContacts),
+		Name:        contact.Name,
+		Phones:      append([]string{}, contact.Phones...),
+		Description: contact.Description,
+		Version:     1,
+		CreatedAt:   tx.now,
+		UpdatedAt:   tx.now,
+	}}
+	tx.putContact(row)
+	tx.revise(row, models.OperationCreate)
+
+	contact.Id, contact.Version, contact.CreatedAt, contact.UpdatedAt = row.Id, row.Version, row.CreatedAt, row.UpdatedAt
+	return nil
+}
+
+func (m *memory) GetContactById(ctx context.Context, userId, contactId uint64) (*models.Contact, error) {
+	var result models.Contact
+	err := m.view(ctx, func(s *memoryTx) error {
+		contact, ok := s.contact(userId, contactId, false)
+		if !ok {
+			return rdbms.ErrNotFound
+		}
+		result = s.output(contact)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateContact updates the contact only if it's still in the given version (zero means any version)
+func (m *memory) UpdateContact(ctx context.Context, userId uint64, contact *models.Contact, version uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		return tx.updateContact(userId, contact, version)
+	})
+}
+
+func (tx *memoryTx) updateContact(userId uint64, contact *models.Contact, version uint64) error {
+	row, err := tx.change(userId, contact.Id, version, func(row *memoryContact) contactChange {
+		row.Name, row.Phones, row.Description = contact.Name, append([]string{}, contact.Phones...), contact.Description
+		return changeContent
+	})
+	if err != nil {
+		return err
+	}
+	tx.revise(row, models.OperationUpdate)
+
+	contact.Version, contact.UpdatedAt = row.Version, row.UpdatedAt
+	return nil
+}
+
+// DeleteContact moves the contact into the trash only if it's still in the given version (zero means any version)
+func (m *memory) DeleteContact(ctx context.Context, userId, contactId, version uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		return tx.deleteContact(userId, contactId, version)
+	})
+}
+
+func (tx *memoryTx) deleteContact(userId, contactId, version uint64) error {
+	row, err := tx.change(userId, contactId, version, func(row *memoryContact) contactChange {
+		row.DeletedAt = &tx.now
+		return changeContent
+	})
+	if err != nil {
+		return err
+	}
+	tx.revise(row, models.OperationDelete)
+	return nil
+}
+
+func (m *memory) RestoreContact(ctx context.Context, userId, contactId uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		old, ok := tx.contact(userId, contactId, true)
+		if !ok {
+			return rdbms.ErrNotFound
+		}
+
+		contact := *old
+		contact.DeletedAt, contact.UpdatedAt = nil, tx.now
+		contact.Version++
+		tx.putContact(&contact)
+		tx.revise(&contact, models.OperationRestore)
+		return nil
+	})
+}
+
+// BatchContacts runs mixed create, update and delete operations of the user, atomic
+// batches fail as a whole (returning the results along with the error) while the others
+// report the failures per operation.
+func (m *memory) BatchContacts(ctx context.Context, userId uint64, operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(operations))
+	for index, operation := range operations {
+		results[index] = models.BatchResult{Index: index, Op: operation.Op, Id: operation.Id}
+	}
+
+	err := m.update(ctx, func(tx *memoryTx) error {
+		for index, operation := range operations {
+			result, mark := &results[index], tx.mark()
+
+			switch {
+			case operation.Op == models.BatchDelete:
+				result.Err = tx.deleteContact(userId, operation.Id, operation.Version)
+			case operation.Contact == nil:
+				result.Err = ErrInvalidOperation
+			case operation.Op == models.BatchCreate:
+				contact := *operation.Contact
+				if result.Err = contact.Validate(); result.Err == nil {
+					result.Err = tx.createContact(userId, &contact)
+					result.Id, result.Version = contact.Id, contact.Version
+				}
+			case operation.Op == models.BatchUpdate:
+				result.Err = tx.batchUpdate(userId, operation, result)
+			default:
+				result.Err = ErrInvalidOperation
+			}
+
+			if result.Err != nil {
+				tx.rollback(mark)
+				if atomic {
+					return result.Err
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		for index := range results {
+			if results[index].Err == nil {
+				results[index].Err = ErrBatchAborted
+			}
+			results[index].Id, results[index].Version = operations[index].Id, 0
+		}
+	}
+
+	return results, err
+}
+
+func (tx *memoryTx) batchUpdate(userId uint64, operation models.BatchOperation, result *models.BatchResult) error {
+	old, ok := tx.contact(userId, operation.Id, false)
+	if !ok {
+		return rdbms.ErrNotFound
+	}
+
+	newContact := *operation.Contact
+	newContact.Update(&old.Contact)
+	if err := newContact.Validate(); err != nil {
+		return err
+	}
+
+	if err := tx.updateContact(userId, &newContact, operation.Version); err != nil {
+		return err
+	}
+
+	result.Version = newContact.Version
+	return nil
+}
+
+// PurgeContacts permanently removes at most limit contacts which have been in the trash
+// for longer than the retention, the purged contacts are returned with their photo.
+func (m *memory) PurgeContacts(ctx context.Context, retention time.Duration, limit int) ([]models.Contact, error) {
+	contacts := []models.Contact{}
+	err := m.update(ctx, func(tx *memoryTx) error {
+		expired := make([]*memoryContact, 0, limit)
+		for _, contact := range tx.contacts {
+			if contact.DeletedAt != nil && contact.DeletedAt.Before(tx.now.Add(-retention)) {
+				expired = append(expired, contact)
+			}
+		}
+
+		sort.Slice(expired, func(i, j int) bool { return expired[i].Id < expired[j].Id })
+		if len(expired) > limit {
+			expired = expired[:limit]
+		}
+
+		for _, contact := range expired {
+			tx.removeContact(contact)
+			contacts = append(contacts, models.Contact{Id: contact.Id, Photo: contact.Photo})
+		}
+		return nil
+	})
+	if err != nil {
+		m.logger.Error("Error purging contacts", zap.Error(err))
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// GetRevisions returns the latest revisions of the contact which are older than the
+// given revision (or the latest ones if it's zero) along with their field-level diffs.
+func (m *memory) GetRevisions(ctx context.Context, userId, contactId, before uint64, limit int) ([]models.Revision, error) {
+	if limit < m.config.Limit.Min {
+		limit = m.config.Limit.Min
+	} else if limit > m.config.Limit.Max {
+		limit = m.config.Limit.Max
+	}
+
+	revisions := []models.Revision{}
+	err := m.view(ctx, func(s *memoryTx) error {
+		if contact, ok := s.contacts[contactId]; !ok || contact.UserId != userId || !s.member(userId) {
+			return nil
+		}
+
+		for _, revision := range s.revisions {
+			if revision.ContactId == contactId && (before == 0 || revision.Id < before) {
+				revisions = append(revisions, revision.Revision)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// keep one extra revision to diff the oldest one against
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Id > revisions[j].Id })
+	if len(revisions) > limit+1 {
+		revisions = revisions[:limit+1]
+	}
+
+	for index := range revisions {
+		if index+1 < len(revisions) {
+			revisions[index].Diff(&revisions[index+1])
+		} else {
+			revisions[index].Diff(nil)
+		}
+	}
+
+	if len(revisions) > limit {
+		revisions = revisions[:limit]
+	}
+	return revisions, nil
+}
+
+// RevertContact restores name, phones and description of the contact from the given revision
+func (m *memory) RevertContact(ctx context.Context, userId, contactId, revisionId uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		revision, ok := tx.revisions[revisionId]
+		if !ok || revision.ContactId != contactId {
+			return rdbms.ErrNotFound
+		}
+
+		row, err := tx.change(userId, contactId, 0, func(row *memoryContact) contactChange {
+			row.Name, row.Phones, row.Description = revision.Name, revision.Phones, revision.Description
+			return changeContent
+		})
+		if err != nil {
+			return err
+		}
+		tx.revise(row, models.OperationRevert)
+		return nil
+	})
+}
+
+// memoryListings are the counterparts of the listings, see listings for their meanings
+var memoryListings = map[models.Listing]struct {
+	filter func(contact *memoryContact) bool
+	key    func(contact *memoryContact) int64
+}{
+	models.ListingAll: {
+		filter: func(c *memoryContact) bool { return c.DeletedAt == nil },
+		key:    func(c *memoryContact) int64 { return int64(c.Id) },
+	},
+	models.ListingFavorites: {
+		filter: func(c *memoryContact) bool { return c.DeletedAt == nil && c.Favorite },
+		key:    func(c *memoryContact) int64 { return int64(c.Id) },
+	},
+	models.ListingRecent: {
+		filter: func(c *memoryContact) bool { return c.DeletedAt == nil && c.LastUsedAt != nil },
+		key:    func(c *memoryContact) int64 { return c.LastUsedAt.UnixMicro() },
+	},
+	models.ListingTrash: {
+		filter: func(c *memoryContact) bool { return c.DeletedAt != nil },
+		key:    func(c *memoryContact) int64 { return c.DeletedAt.UnixMicro() },
+	},
+}
+
+func (m *memory) GetContacts(ctx context.Context, userId uint64, query *models.ContactsQuery) (*models.ContactsPage, error) {
+	lq, err := prepareListing(m.config, query)
+	if err != nil {
+		return nil, err
+	}
+	listing := memoryListings[query.Listing]
+
+	type row struct {
+		contact *memoryContact
+		key     int64
+	}
+
+	var page *models.ContactsPage
+	err = m.view(ctx, func(s *memoryTx) error {
+		rows, total := []row{}, 0
+		for _, contact := range s.contacts {
+			if contact.UserId != userId || !s.member(userId) || !listing.filter(contact) || !strings.Contains(contact.Name, query.Search) {
+				continue
+			} else if len(query.Tag) != 0 && !s.tagged(contact.Id, query.Tag) {
+				continue
+			}
+			total++
+
+			key := listing.key(contact)
+			if len(query.Cursor) != 0 {
+				// the rows after the cursor in the fetch order
+				after := key > lq.cursor.Key || (key == lq.cursor.Key && contact.Id > lq.cursor.Id)
+				if lq.reversed() {
+					after = key < lq.cursor.Key || (key == lq.cursor.Key && contact.Id < lq.cursor.Id)
+				}
+				if !after {
+					continue
+				}
+			}
+			rows = append(rows, row{contact: contact, key: key})
+		}
+
+		sort.Slice(rows, func(i, j int) bool {
+			less := rows[i].key < rows[j].key || (rows[i].key == rows[j].key && rows[i].contact.Id < rows[j].contact.Id)
+			return less != lq.reversed()
+		})
+
+		// keep one extra row to find out whether there's another page in the direction
+		if len(rows) > lq.limit+1 {
+			rows = rows[:lq.limit+1]
+		}
+
+		contacts, keys := make([]models.Contact, len(rows)), make([]int64, len(rows))
+		for index, row := range rows {
+			contacts[index], keys[index] = s.output(row.contact), row.key
+		}
+
+		var err error
+		if page, err = lq.page(m.config, query, contacts, keys); err != nil {
+			return err
+		}
+
+		if query.Total {
+			page.Total = &total
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// tagged tells whether the contact has a tag with the given name
+func (s *memoryState) tagged(contactId uint64, name string) bool {
+	for tagId := range s.contactTags[contactId] {
+		if s.tags[tagId].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memory) SetContactFavorite(ctx context.Context, userId, contactId uint64, favorite bool) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		_, err := tx.change(userId, contactId, 0, func(row *memoryContact) contactChange {
+			row.Favorite = favorite
+			return changeAttribute
+		})
+		return err
+	})
+}
+
+func (m *memory) UseContact(ctx context.Context, userId, contactId uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		_, err := tx.change(userId, contactId, 0, func(row *memoryContact) contactChange {
+			row.UsageCount, row.LastUsedAt = row.UsageCount+1, &tx.now
+			return changeUsage
+		})
+		return err
+	})
+}
+
+// SetContactPhoto sets the storage key prefix of the contact photo, an empty one removes it
+func (m *memory) SetContactPhoto(ctx context.Context, userId, contactId uint64, photo string) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		_, err := tx.change(userId, contactId, 0, func(row *memoryContact) contactChange {
+			row.Photo = photo
+			return changeAttribute
+		})
+		return err
+	})
+}
+
+func (m *memory) CreateTag(ctx context.Context, userId uint64, tag *models.Tag) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		count := 0
+		for _, other := range tx.tags {
+			if other.UserId != userId {
+				continue
+			} else if other.Name == tag.Name {
+				return rdbms.ErrDuplicate
+			}
+			count++
+		}
+
+		if count >= m.config.MaxTags {
+			return ErrTagsLimitExceeded
+		} else if !tx.member(userId) {
+			return rdbms.ErrForeignKey
+		}
+
+		tag.Id = tx.next(tableTags)
+		tx.putTag(&memoryTag{UserId: userId, Tag: *tag})
+		return nil
+	})
+}
+
+func (m *memory) GetTagById(ctx context.Context, userId, tagId uint64) (*models.Tag, error) {
+	var result models.Tag
+	err := m.view(ctx, func(s *memoryTx) error {
+		tag, ok := s.tags[tagId]
+		if !ok || tag.UserId != userId || !s.member(userId) {
+			return rdbms.ErrNotFound
+		}
+		result = tag.Tag
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (m *memory) GetTags(ctx context.Context, userId uint64) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := m.view(ctx, func(s *memoryTx) error {
+		for _, tag := range s.tags {
+			if tag.UserId == userId && s.member(userId) {
+				tags = append(tags, tag.Tag)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	if len(tags) > m.config.MaxTags {
+		tags = tags[:m.config.MaxTags]
+	}
+	return tags, nil
+}
+
+// the tag is a part of its contacts, so their version is incremented too
+func (tx *memoryTx) bumpTagged(tagId uint64) {
+	for contactId, tags := range tx.contactTags {
+		if tags[tagId] {
+			tx.bump(contactId)
+		}
+	}
+}
+
+func (tx *memoryTx) bump(contactId uint64) {
+	contact := *tx.contacts[contactId]
+	contact.Version++
+	tx.putContact(&contact)
+}
+
+func (m *memory) UpdateTag(ctx context.Context, userId uint64, tag *models.Tag) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		if old, ok := tx.tags[tag.Id]; !ok || old.UserId != userId || !tx.member(userId) {
+			return rdbms.ErrNotFound
+		}
+
+		for _, other := range tx.tags {
+			if other.UserId == userId && other.Id != tag.Id && other.Name == tag.Name {
+				return rdbms.ErrDuplicate
+			}
+		}
+
+		tx.putTag(&memoryTag{UserId: userId, Tag: *tag})
+		tx.bumpTagged(tag.Id)
+		return nil
+	})
+}
+
+func (m *memory) DeleteTag(ctx context.Context, userId, tagId uint64) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		if tag, ok := tx.tags[tagId]; !ok || tag.UserId != userId || !tx.member(userId) {
+			return rdbms.ErrNotFound
+		}
+
+		tx.bumpTagged(tagId)
+		for contactId := range tx.contactTags {
+			tx.setContactTag(contactId, tagId, false)
+		}
+		setRow(tx, tableTags, tx.tags, tagId, nil, false)
+		return nil
+	})
+}
+
+// only the contacts and the tag owned by the user are affected,
+// the ids of other users are silently ignored.
+func (m *memory) TagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error {
+	return m.setTags(ctx, userId, tagId, contactIds, true)
+}
+
+func (m *memory) UntagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error {
+	return m.setTags(ctx, userId, tagId, contactIds, false)
+}
+
+func (m *memory) setTags(ctx context.Context, userId, tagId uint64, contactIds []uint64, tagged bool) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		if tag, ok := tx.tags[tagId]; !ok || tag.UserId != userId || !tx.member(userId) {
+			return nil
+		}
+
+		for _, contactId := range contactIds {
+			contact, ok := tx.contacts[contactId]
+			if !ok || contact.UserId != userId || (tagged && contact.DeletedAt != nil) {
+				continue
+			}
+
+			if tx.setContactTag(contactId, tagId, tagged) {
+				tx.bump(contactId)
+			}
+		}
+		return nil
+	})
+}
+
+func (m *memory) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		for _, other := range tx.organizations {
+			if other.Slug == org.Slug {
+				return rdbms.ErrDuplicate
+			}
+		}
+
+		row := &models.Organization{Slug: org.Slug, Name: org.Name, MaxUsers: org.MaxUsers, MaxContacts: org.MaxContacts, CreatedAt: tx.now}
+		row.Id = tx.next(tableOrganizations)
+		tx.putOrganization(row)
+
+		org.Id, org.CreatedAt = row.Id, row.CreatedAt
+		return nil
+	})
+}
+
+func (m *memory) GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	var result models.Organization
+	err := m.view(ctx, func(s *memoryTx) error {
+		for _, org := range s.organizations {
+			if org.Slug == slug {
+				result = *org
+				return nil
+			}
+		}
+		return rdbms.ErrNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (m *memory) GetOrganizations(ctx context.Context) ([]models.Organization, error) {
+	orgs := []models.Organization{}
+	err := m.view(ctx, func(s *memoryTx) error {
+		for _, org := range s.organizations {
+			orgs = append(orgs, *org)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Slug < orgs[j].Slug })
+	return orgs, nil
+}
+
+func (m *memory) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	return m.update(ctx, func(tx *memoryTx) error {
+		old, ok := tx.organizations[org.Id]
+		if !ok {
+			return rdbms.ErrNotFound
+		}
+
+		row := *old
+		row.Name, row.MaxUsers, row.MaxContacts = org.Name, org.MaxUsers, org.MaxContacts
+		tx.putOrganization(&row)
+		return nil
+	})
+}
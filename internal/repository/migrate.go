@@ -0,0 +1,469 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"github.com/mohammadne/phone-book/pkg/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrMigrationModified = errors.New("Error applied migration has been modified")
+	ErrMigrationMissing  = errors.New("Error applied migration doesn't exist anymore")
+	ErrMigrationVersion  = errors.New("Error unknown migration version")
+	ErrMigrationConflict = errors.New("Error existing rows conflict with the migration")
+)
+
+// migrationLockKey identifies the advisory lock which serializes the migrations of all instances
+const migrationLockKey int64 = 0x70686f6e65626f6f
+
+//go:embed migrations
+var migrations embed.FS
+
+// migration is a pair of up and down files named as <version>_<name>.<direction>.sql
+type migration struct {
+	version  uint64
+	name     string
+	up, down string
+	checksum string
+}
+
+// step is a single migration to apply in the direction
+type step struct {
+	migration *migration
+	direction models.Migrate
+}
+
+const QueryCreateSchemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum CHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+const QuerySchemaMigrationsExists = `
+SELECT to_regclass('schema_migrations') IS NOT NULL;`
+
+const QueryGetSchemaMigrations = `
+SELECT version, name, checksum, applied_at
+FROM schema_migrations
+ORDER BY version;`
+
+const QueryInsertSchemaMigration = `
+INSERT INTO schema_migrations(version, name, checksum)
+VALUES ($1, $2, $3);`
+
+const QueryDeleteSchemaMigration = `
+DELETE FROM schema_migrations
+WHERE version=$1;`
+
+const QueryUsersExists = `
+SELECT to_regclass('users') IS NOT NULL;`
+
+// QueryDuplicateEmails lists the emails which several users have registered regardless of their case
+const QueryDuplicateEmails = `
+SELECT LOWER(email) || ' (users ' || string_agg(id::TEXT, ', ' ORDER BY id) || ')'
+FROM users
+GROUP BY LOWER(email)
+HAVING COUNT(*) > 1
+ORDER BY LOWER(email);`
+
+// prechecks are the queries listing the rows which a step can't be applied on, by its direction and version.
+// The applied migrations can't be changed (their checksums are verified), so the checks live here instead.
+var prechecks = map[models.Migrate]map[uint64]string{
+	// 000011 creates the case-insensitive unique index on the emails
+	models.Up: {11: QueryDuplicateEmails},
+	// 000014 recreates the same index when it's reverted
+	models.Down: {14: QueryDuplicateEmails},
+}
+
+type appliedMigration struct {
+	Version   uint64    `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// loadMigrations reads the embedded migrations ordered by their version
+func loadMigrations() ([]*migration, error) {
+	files, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading migrations directory:\n%v", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	// versions are zero-padded, so the files are sorted by their version
+	names = utils.Sort(names)
+
+	result := make([]*migration, 0, len(names)/2)
+	byVersion := make(map[uint64]*migration)
+
+	for _, file := range names {
+		prefix, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		rawVersion, name, hasName := strings.Cut(prefix, "_")
+		version, err := strconv.ParseUint(rawVersion, 10, 64)
+		if !ok || !hasName || err != nil || version == 0 || (direction != string(models.Up) && direction != string(models.Down)) {
+			return nil, fmt.Errorf("Error invalid migration file name: %s", file)
+		}
+
+		data, err := fs.ReadFile(migrations, "migrations/"+file)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading migration file: %s\n%v", file, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+			result = append(result, m)
+		} else if m.name != name {
+			return nil, fmt.Errorf("Error migration version %d has several names", version)
+		}
+
+		if direction == string(models.Up) {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	for _, m := range result {
+		if len(m.up) == 0 || len(m.down) == 0 {
+			return nil, fmt.Errorf("Error migration %d_%s needs both of up and down files", m.version, m.name)
+		}
+
+		hash := sha256.Sum256([]byte(m.up + "\x00" + m.down))
+		m.checksum = hex.EncodeToString(hash[:])
+	}
+
+	return result, nil
+}
+
+// readApplied returns the applied migrations ordered by version, the bookkeeping table
+// is created if it's missing unless create is false (then nothing is considered applied).
+func (r *repository) readApplied(ctx context.Context, create bool) ([]appliedMigration, error) {
+	if create {
+		if err := r.rdbms.Execute(ctx, QueryCreateSchemaMigrations, []any{}); err != nil {
+			return nil, fmt.Errorf("Error creating the schema_migrations table:\n%w", err)
+		}
+	} else {
+		var exists bool
+		if err := r.rdbms.QueryRow(ctx, QuerySchemaMigrationsExists, []any{}, []any{&exists}); err != nil {
+			return nil, fmt.Errorf("Error checking the schema_migrations table:\n%w", err)
+		} else if !exists {
+			return []appliedMigration{}, nil
+		}
+	}
+
+	rows, err := rdbms.CollectStructs[appliedMigration](ctx, r.rdbms, QueryGetSchemaMigrations, []any{})
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the applied migrations:\n%w", err)
+	}
+	return rows, nil
+}
+
+// state loads the migrations and the applied ones, it fails if any applied migration
+// has been modified or removed since, as the schema can't be reasoned about anymore.
+func (r *repository) state(ctx context.Context, create bool) ([]*migration, map[uint64]bool, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := r.readApplied(ctx, create)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byVersion := make(map[uint64]*migration, len(all))
+	for _, m := range all {
+		byVersion[m.version] = m
+	}
+
+	applied := make(map[uint64]bool, len(rows))
+	for _, row := range rows {
+		m, ok := byVersion[row.Version]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %d_%s", ErrMigrationMissing, row.Version, row.Name)
+		} else if m.checksum != row.Checksum {
+			return nil, nil, fmt.Errorf("%w: %d_%s", ErrMigrationModified, m.version, m.name)
+		}
+		applied[row.Version] = true
+	}
+
+	return all, applied, nil
+}
+
+// withMigrationLock runs the function while no other instance is migrating the database,
+// the state has to be read inside of the function as others may have changed it meanwhile.
+func (r *repository) withMigrationLock(ctx context.Context, fn func() error) error {
+	lockCtx, cancel := context.WithCancel(ctx)
+	if r.config.MigrationLockTimeout > 0 {
+		lockCtx, cancel = context.WithTimeout(ctx, r.config.MigrationLockTimeout)
+	}
+	defer cancel()
+
+	r.logger.Info("Waiting for the migration lock", zap.Duration("timeout", r.config.MigrationLockTimeout))
+	start := time.Now()
+
+	unlock, err := r.rdbms.Lock(lockCtx, migrationLockKey)
+	if err != nil {
+		r.logger.Error("Error acquiring the migration lock", zap.Duration("waited", time.Since(start)), zap.Error(err))
+		return err
+	}
+	r.logger.Info("Migration lock has been acquired", zap.Duration("waited", time.Since(start)))
+
+	defer func() {
+		if err := unlock(); err != nil {
+			r.logger.Error("Error releasing the migration lock", zap.Error(err))
+			return
+		}
+		r.logger.Info("Migration lock has been released")
+	}()
+
+	return fn()
+}
+
+func (r *repository) Migrate(ctx context.Context, direction models.Migrate, steps int) error {
+	return r.withMigrationLock(ctx, func() error {
+		all, applied, err := r.state(ctx, true)
+		if err != nil {
+			return err
+		}
+		return r.apply(ctx, planSteps(all, applied, direction, steps))
+	})
+}
+
+func (r *repository) MigrateTo(ctx context.Context, version uint64) error {
+	return r.withMigrationLock(ctx, func() error {
+		all, applied, err := r.state(ctx, true)
+		if err != nil {
+			return err
+		}
+
+		plan, err := planTo(all, applied, version)
+		if err != nil {
+			return err
+		}
+		return r.apply(ctx, plan)
+	})
+}
+
+// PlanMigrate returns the steps which Migrate would run with the same arguments, without running them
+func (r *repository) PlanMigrate(ctx context.Context, direction models.Migrate, steps int) ([]models.MigrationStep, error) {
+	all, applied, err := r.state(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.toMigrationSteps(ctx, planSteps(all, applied, direction, steps))
+}
+
+// PlanMigrateTo returns the steps which MigrateTo would run with the same version, without running them
+func (r *repository) PlanMigrateTo(ctx context.Context, version uint64) ([]models.MigrationStep, error) {
+	all, applied, err := r.state(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planTo(all, applied, version)
+	if err != nil {
+		return nil, err
+	}
+	return r.toMigrationSteps(ctx, plan)
+}
+
+// planSteps applies the pending migrations from the oldest or reverts the applied ones
+// from the newest, all of them are planned when steps isn't positive.
+func planSteps(all []*migration, applied map[uint64]bool, direction models.Migrate, steps int) []step {
+	plan := make([]step, 0, len(all))
+	if direction == models.Up {
+		for _, m := range all {
+			if !applied[m.version] {
+				plan = append(plan, step{migration: m, direction: models.Up})
+			}
+		}
+	} else {
+		for index := len(all) - 1; index >= 0; index-- {
+			if m := all[index]; applied[m.version] {
+				plan = append(plan, step{migration: m, direction: models.Down})
+			}
+		}
+	}
+
+	if steps > 0 && steps < len(plan) {
+		plan = plan[:steps]
+	}
+	return plan
+}
+
+// planTo reverts the applied migrations newer than the version, then applies the pending ones up to it
+func planTo(all []*migration, applied map[uint64]bool, version uint64) ([]step, error) {
+	known := version == 0
+	for _, m := range all {
+		known = known || m.version == version
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %d", ErrMigrationVersion, version)
+	}
+
+	plan := make([]step, 0, len(all))
+	for index := len(all) - 1; index >= 0; index-- {
+		if m := all[index]; m.version > version && applied[m.version] {
+			plan = append(plan, step{migration: m, direction: models.Down})
+		}
+	}
+	for _, m := range all {
+		if m.version <= version && !applied[m.version] {
+			plan = append(plan, step{migration: m, direction: models.Up})
+		}
+	}
+	return plan, nil
+}
+
+// toMigrationSteps describes the plan, the conflicts are checked against the current rows
+// so the earlier steps of the same plan aren't taken into account.
+func (r *repository) toMigrationSteps(ctx context.Context, plan []step) ([]models.MigrationStep, error) {
+	result := make([]models.MigrationStep, 0, len(plan))
+	for _, s := range plan {
+		statement := s.migration.up
+		if s.direction == models.Down {
+			statement = s.migration.down
+		}
+
+		conflicts, err := conflicts(ctx, r.rdbms, s)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, models.MigrationStep{
+			Version: s.migration.version, Name: s.migration.name, Direction: s.direction, Statement: statement, Conflicts: conflicts,
+		})
+	}
+	return result, nil
+}
+
+// conflicts runs the precheck of the step, every returned line describes a group of conflicting rows
+func conflicts(ctx context.Context, db rdbms.RDBMS, s step) ([]string, error) {
+	query, ok := prechecks[s.direction][s.migration.version]
+	if !ok {
+		return []string{}, nil
+	}
+
+	// nothing can conflict before the users have been created
+	var exists bool
+	if err := db.QueryRow(ctx, QueryUsersExists, []any{}, []any{&exists}); err != nil {
+		return nil, fmt.Errorf("Error checking the users table:\n%w", err)
+	} else if !exists {
+		return []string{}, nil
+	}
+
+	result, err := rdbms.Collect(ctx, db, query, []any{}, func(row rdbms.Row, value *string) error {
+		return row.Scan(value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error checking the conflicts of %d_%s %s:\n%w", s.migration.version, s.migration.name, s.direction, err)
+	}
+	return result, nil
+}
+
+// apply runs every step inside its own transaction along with its bookkeeping,
+// so a failing migration leaves neither a partial schema change nor a wrong record.
+func (r *repository) apply(ctx context.Context, plan []step) error {
+	if len(plan) == 0 {
+		r.logger.Info("No migration to apply, the schema is up to date")
+		return nil
+	}
+
+	for _, s := range plan {
+		m := s.migration
+		r.logger.Info("Applying migration", zap.Uint64("version", m.version), zap.String("name", m.name), zap.String("direction", string(s.direction)))
+
+		err := r.rdbms.WithTx(ctx, func(tx rdbms.RDBMS) error {
+			// checked inside of the transaction, so the reported rows are the ones which failed it
+			if conflicts, err := conflicts(ctx, tx, s); err != nil {
+				return err
+			} else if len(conflicts) > 0 {
+				return fmt.Errorf("%w, resolve them and retry:\n%s", ErrMigrationConflict, strings.Join(conflicts, "\n"))
+			}
+
+			if s.direction == models.Up {
+				if err := tx.Execute(ctx, m.up, []any{}); err != nil {
+					return err
+				}
+				return tx.Execute(ctx, QueryInsertSchemaMigration, []any{m.version, m.name, m.checksum})
+			}
+
+			if err := tx.Execute(ctx, m.down, []any{}); err != nil {
+				return err
+			}
+			return tx.Execute(ctx, QueryDeleteSchemaMigration, []any{m.version})
+		})
+		if err != nil {
+			return fmt.Errorf("Error migrating %d_%s %s:\n%w", m.version, m.name, s.direction, err)
+		}
+	}
+
+	return nil
+}
+
+// Migrations returns the status of every known or applied migration ordered by version,
+// unlike the other operations it reports the modified and missing migrations instead of failing.
+func (r *repository) Migrations(ctx context.Context) ([]models.Migration, error) {
+	all, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.readApplied(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint64]*appliedMigration, len(rows))
+	for index := range rows {
+		applied[rows[index].Version] = &rows[index]
+	}
+
+	result := make([]models.Migration, 0, len(all)+len(rows))
+	for _, m := range all {
+		status := models.Migration{Version: m.version, Name: m.name, State: models.MigrationPending}
+		if row, ok := applied[m.version]; ok {
+			status.State, status.AppliedAt = models.MigrationApplied, &row.AppliedAt
+			if row.Checksum != m.checksum {
+				status.State = models.MigrationModified
+			}
+			delete(applied, m.version)
+		}
+		result = append(result, status)
+	}
+
+	// rows are ordered, so the missing migrations keep their relative order
+	for index := range rows {
+		if row := &rows[index]; applied[row.Version] != nil {
+			missing := models.Migration{Version: row.Version, Name: row.Name, State: models.MigrationMissing, AppliedAt: &row.AppliedAt}
+			position := len(result)
+			for position > 0 && result[position-1].Version > row.Version {
+				position--
+			}
+			result = append(result[:position], append([]models.Migration{missing}, result[position:]...)...)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags(
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(30) NOT NULL,
+	color VARCHAR(7) NOT NULL,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS contact_tags(
+	contact_id INTEGER NOT NULL REFERENCES contacts (id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	PRIMARY KEY (contact_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS contact_tags_tag_id_idx ON contact_tags (tag_id);
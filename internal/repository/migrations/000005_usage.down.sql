@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS contacts_last_used_at_idx;
+DROP INDEX IF EXISTS contacts_favorite_idx;
+
+ALTER TABLE contacts DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE contacts DROP COLUMN IF EXISTS usage_count;
+ALTER TABLE contacts DROP COLUMN IF EXISTS favorite;
@@ -0,0 +1,6 @@
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS favorite BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS usage_count BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS contacts_favorite_idx ON contacts (user_id, id) WHERE favorite;
+CREATE INDEX IF NOT EXISTS contacts_last_used_at_idx ON contacts (user_id, last_used_at DESC, id DESC) WHERE last_used_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS photo VARCHAR(255);
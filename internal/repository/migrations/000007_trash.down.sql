@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS contacts_deleted_at_idx;
+
+DELETE FROM contacts WHERE deleted_at IS NOT NULL;
+ALTER TABLE contacts DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS contact_revisions(
+	id BIGSERIAL PRIMARY KEY,
+	contact_id INTEGER NOT NULL REFERENCES contacts (id) ON DELETE CASCADE,
+	operation VARCHAR(10) NOT NULL,
+	name VARCHAR(50) NOT NULL,
+	phones VARCHAR(15)[] NOT NULL,
+	description VARCHAR(255),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS contact_revisions_contact_id_idx ON contact_revisions (contact_id, id DESC);
@@ -0,0 +1,2 @@
+ALTER TABLE contact_revisions DROP COLUMN IF EXISTS version;
+ALTER TABLE contacts DROP COLUMN IF EXISTS version;
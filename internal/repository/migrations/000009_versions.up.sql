@@ -0,0 +1,2 @@
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE contact_revisions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,25 @@
+ALTER TABLE contact_revisions ALTER COLUMN id DROP IDENTITY IF EXISTS;
+CREATE SEQUENCE IF NOT EXISTS contact_revisions_id_seq OWNED BY contact_revisions.id;
+SELECT setval('contact_revisions_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM contact_revisions;
+ALTER TABLE contact_revisions ALTER COLUMN id SET DEFAULT nextval('contact_revisions_id_seq');
+
+ALTER TABLE tags ALTER COLUMN id DROP IDENTITY IF EXISTS;
+CREATE SEQUENCE IF NOT EXISTS tags_id_seq AS INTEGER OWNED BY tags.id;
+SELECT setval('tags_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM tags;
+ALTER TABLE tags ALTER COLUMN id SET DEFAULT nextval('tags_id_seq');
+
+ALTER TABLE contacts ALTER COLUMN id DROP IDENTITY IF EXISTS;
+CREATE SEQUENCE IF NOT EXISTS contacts_id_seq AS INTEGER OWNED BY contacts.id;
+SELECT setval('contacts_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM contacts;
+ALTER TABLE contacts ALTER COLUMN id SET DEFAULT nextval('contacts_id_seq');
+
+ALTER TABLE users ALTER COLUMN id DROP IDENTITY IF EXISTS;
+CREATE SEQUENCE IF NOT EXISTS users_id_seq AS INTEGER OWNED BY users.id;
+SELECT setval('users_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM users;
+ALTER TABLE users ALTER COLUMN id SET DEFAULT nextval('users_id_seq');
+
+ALTER TABLE contact_revisions ALTER COLUMN contact_id TYPE INTEGER;
+ALTER TABLE contact_tags ALTER COLUMN contact_id TYPE INTEGER, ALTER COLUMN tag_id TYPE INTEGER;
+ALTER TABLE tags ALTER COLUMN id TYPE INTEGER, ALTER COLUMN user_id TYPE INTEGER;
+ALTER TABLE contacts ALTER COLUMN id TYPE INTEGER, ALTER COLUMN user_id TYPE INTEGER;
+ALTER TABLE users ALTER COLUMN id TYPE INTEGER;
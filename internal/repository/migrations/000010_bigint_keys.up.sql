@@ -0,0 +1,27 @@
+-- keys are BIGINT identities matching the uint64 ids of the application,
+-- the identities continue from the last values of the replaced sequences.
+ALTER TABLE users ALTER COLUMN id TYPE BIGINT;
+ALTER TABLE contacts ALTER COLUMN id TYPE BIGINT, ALTER COLUMN user_id TYPE BIGINT;
+ALTER TABLE tags ALTER COLUMN id TYPE BIGINT, ALTER COLUMN user_id TYPE BIGINT;
+ALTER TABLE contact_tags ALTER COLUMN contact_id TYPE BIGINT, ALTER COLUMN tag_id TYPE BIGINT;
+ALTER TABLE contact_revisions ALTER COLUMN contact_id TYPE BIGINT;
+
+ALTER TABLE users ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS users_id_seq;
+ALTER TABLE users ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('users', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM users;
+
+ALTER TABLE contacts ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS contacts_id_seq;
+ALTER TABLE contacts ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('contacts', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM contacts;
+
+ALTER TABLE tags ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS tags_id_seq;
+ALTER TABLE tags ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('tags', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM tags;
+
+ALTER TABLE contact_revisions ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE IF EXISTS contact_revisions_id_seq;
+ALTER TABLE contact_revisions ALTER COLUMN id ADD GENERATED BY DEFAULT AS IDENTITY;
+SELECT setval(pg_get_serial_sequence('contact_revisions', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM contact_revisions;
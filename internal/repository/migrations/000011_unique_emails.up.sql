@@ -0,0 +1,3 @@
+-- emails are unique regardless of their case,
+-- the existing duplicates have to be resolved before applying it.
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (LOWER(email));
@@ -0,0 +1,9 @@
+ALTER TABLE tags 
+	DROP CONSTRAINT IF EXISTS tags_user_id_fkey,
+	ADD CONSTRAINT tags_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE contacts 
+	DROP CONSTRAINT IF EXISTS contacts_user_id_fkey,
+	ADD CONSTRAINT contacts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE contacts ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,11 @@
+-- contacts without any owner aren't reachable by any query
+DELETE FROM contacts WHERE user_id IS NULL;
+ALTER TABLE contacts ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE contacts 
+	DROP CONSTRAINT IF EXISTS contacts_user_id_fkey,
+	ADD CONSTRAINT contacts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE tags 
+	DROP CONSTRAINT IF EXISTS tags_user_id_fkey,
+	ADD CONSTRAINT tags_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS tags_updated_at ON tags;
+DROP TRIGGER IF EXISTS contacts_updated_at ON contacts;
+DROP TRIGGER IF EXISTS users_updated_at ON users;
+
+ALTER TABLE tags DROP COLUMN IF EXISTS updated_at, DROP COLUMN IF EXISTS created_at;
+ALTER TABLE contacts DROP COLUMN IF EXISTS updated_at, DROP COLUMN IF EXISTS created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS updated_at, ALTER COLUMN created_at DROP NOT NULL;
+
+DROP FUNCTION IF EXISTS set_updated_at();
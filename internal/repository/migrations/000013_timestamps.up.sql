@@ -0,0 +1,43 @@
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+	NEW.updated_at = CURRENT_TIMESTAMP;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+UPDATE users SET created_at=CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE users 
+	ALTER COLUMN created_at SET NOT NULL,
+	ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE contacts 
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE tags 
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- the history of the existing contacts is the best guess of their timestamps
+UPDATE contacts 
+SET created_at=history.created_at, updated_at=history.updated_at 
+FROM (
+	SELECT contact_id, MIN(created_at) AS created_at, MAX(created_at) AS updated_at 
+	FROM contact_revisions 
+	GROUP BY contact_id
+) AS history 
+WHERE history.contact_id = contacts.id;
+
+DROP TRIGGER IF EXISTS users_updated_at ON users;
+CREATE TRIGGER users_updated_at BEFORE UPDATE ON users 
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- only changes of the contact's own fields are updates, not its usage statistics
+-- (the version is bumped on every change, so it's not a part of the columns list)
+DROP TRIGGER IF EXISTS contacts_updated_at ON contacts;
+CREATE TRIGGER contacts_updated_at BEFORE UPDATE OF name, phones, description, favorite, photo, deleted_at ON contacts 
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+DROP TRIGGER IF EXISTS tags_updated_at ON tags;
+CREATE TRIGGER tags_updated_at BEFORE UPDATE ON tags 
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,20 @@
+DROP TRIGGER IF EXISTS contacts_count_delete ON contacts;
+DROP TRIGGER IF EXISTS contacts_count_insert ON contacts;
+DROP TRIGGER IF EXISTS users_count_delete ON users;
+DROP TRIGGER IF EXISTS users_count_insert ON users;
+DROP FUNCTION IF EXISTS count_contacts();
+DROP FUNCTION IF EXISTS count_users();
+
+ALTER TABLE tags DROP CONSTRAINT IF EXISTS tags_organization_id_user_id_fkey, DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE contacts DROP CONSTRAINT IF EXISTS contacts_organization_id_user_id_fkey, DROP COLUMN IF EXISTS organization_id;
+
+-- fails if the same email has been registered in several organizations
+DROP INDEX IF EXISTS users_organization_id_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (LOWER(email));
+
+ALTER TABLE users 
+	DROP CONSTRAINT IF EXISTS users_organization_id_id_key,
+	DROP CONSTRAINT IF EXISTS users_organization_id_fkey,
+	DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
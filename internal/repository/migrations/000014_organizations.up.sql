@@ -0,0 +1,115 @@
+-- organizations are the tenants, they own the users and (through them) the contacts and tags.
+-- the limits are enforced by the counters, an absent limit means unlimited.
+CREATE TABLE IF NOT EXISTS organizations(
+	id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	slug VARCHAR(63) NOT NULL UNIQUE,
+	name VARCHAR(100) NOT NULL,
+	max_users INTEGER,
+	max_contacts INTEGER,
+	users_count INTEGER NOT NULL DEFAULT 0,
+	contacts_count INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS organizations_updated_at ON organizations;
+CREATE TRIGGER organizations_updated_at BEFORE UPDATE OF slug, name, max_users, max_contacts ON organizations 
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- the existing data belongs to the default organization
+INSERT INTO organizations(id, slug, name) VALUES(1, 'default', 'Default') ON CONFLICT DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), (SELECT MAX(id) FROM organizations));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS organization_id BIGINT;
+UPDATE users SET organization_id=1 WHERE organization_id IS NULL;
+ALTER TABLE users 
+	ALTER COLUMN organization_id SET NOT NULL,
+	ADD CONSTRAINT users_organization_id_fkey FOREIGN KEY (organization_id) REFERENCES organizations (id) ON DELETE CASCADE,
+	ADD CONSTRAINT users_organization_id_id_key UNIQUE (organization_id, id);
+
+-- emails are only unique inside of their organization
+DROP INDEX IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_organization_id_email_key ON users (organization_id, LOWER(email));
+
+-- the owned rows can't belong to a user of another organization
+ALTER TABLE contacts ADD COLUMN IF NOT EXISTS organization_id BIGINT;
+UPDATE contacts SET organization_id=users.organization_id FROM users WHERE users.id = contacts.user_id;
+ALTER TABLE contacts 
+	ALTER COLUMN organization_id SET NOT NULL,
+	ADD CONSTRAINT contacts_organization_id_user_id_fkey FOREIGN KEY (organization_id, user_id) 
+		REFERENCES users (organization_id, id) ON DELETE CASCADE;
+
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS organization_id BIGINT;
+UPDATE tags SET organization_id=users.organization_id FROM users WHERE users.id = tags.user_id;
+ALTER TABLE tags 
+	ALTER COLUMN organization_id SET NOT NULL,
+	ADD CONSTRAINT tags_organization_id_user_id_fkey FOREIGN KEY (organization_id, user_id) 
+		REFERENCES users (organization_id, id) ON DELETE CASCADE;
+
+UPDATE organizations SET 
+	users_count=(SELECT COUNT(*) FROM users WHERE users.organization_id = organizations.id),
+	contacts_count=(SELECT COUNT(*) FROM contacts WHERE contacts.organization_id = organizations.id);
+
+-- the counters are maintained once per statement (bulk inserts update each organization once),
+-- exceeding a limit fails the statement like a check constraint would.
+CREATE OR REPLACE FUNCTION count_users() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE organizations SET users_count=users_count+changed.count 
+		FROM (SELECT organization_id, COUNT(*) AS count FROM new_rows GROUP BY organization_id) AS changed 
+		WHERE organizations.id = changed.organization_id;
+
+		IF EXISTS (
+			SELECT 1 FROM organizations 
+			WHERE id IN (SELECT organization_id FROM new_rows) AND users_count > max_users
+		) THEN
+			RAISE EXCEPTION 'organization has reached its users limit' 
+				USING ERRCODE = 'check_violation', CONSTRAINT = 'organizations_users_limit';
+		END IF;
+	ELSE
+		UPDATE organizations SET users_count=users_count-changed.count 
+		FROM (SELECT organization_id, COUNT(*) AS count FROM old_rows GROUP BY organization_id) AS changed 
+		WHERE organizations.id = changed.organization_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION count_contacts() RETURNS TRIGGER AS $$
+BEGIN
+	IF TG_OP = 'INSERT' THEN
+		UPDATE organizations SET contacts_count=contacts_count+changed.count 
+		FROM (SELECT organization_id, COUNT(*) AS count FROM new_rows GROUP BY organization_id) AS changed 
+		WHERE organizations.id = changed.organization_id;
+
+		IF EXISTS (
+			SELECT 1 FROM organizations 
+			WHERE id IN (SELECT organization_id FROM new_rows) AND contacts_count > max_contacts
+		) THEN
+			RAISE EXCEPTION 'organization has reached its contacts limit' 
+				USING ERRCODE = 'check_violation', CONSTRAINT = 'organizations_contacts_limit';
+		END IF;
+	ELSE
+		UPDATE organizations SET contacts_count=contacts_count-changed.count 
+		FROM (SELECT organization_id, COUNT(*) AS count FROM old_rows GROUP BY organization_id) AS changed 
+		WHERE organizations.id = changed.organization_id;
+	END IF;
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_count_insert ON users;
+CREATE TRIGGER users_count_insert AFTER INSERT ON users 
+REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE FUNCTION count_users();
+
+DROP TRIGGER IF EXISTS users_count_delete ON users;
+CREATE TRIGGER users_count_delete AFTER DELETE ON users 
+REFERENCING OLD TABLE AS old_rows FOR EACH STATEMENT EXECUTE FUNCTION count_users();
+
+DROP TRIGGER IF EXISTS contacts_count_insert ON contacts;
+CREATE TRIGGER contacts_count_insert AFTER INSERT ON contacts 
+REFERENCING NEW TABLE AS new_rows FOR EACH STATEMENT EXECUTE FUNCTION count_contacts();
+
+DROP TRIGGER IF EXISTS contacts_count_delete ON contacts;
+CREATE TRIGGER contacts_count_delete AFTER DELETE ON contacts 
+REFERENCING OLD TABLE AS old_rows FOR EACH STATEMENT EXECUTE FUNCTION count_contacts();
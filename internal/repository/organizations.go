@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUsersLimitExceeded    = errors.New("Error organization has reached its users limit")
+	ErrContactsLimitExceeded = errors.New("Error organization has reached its contacts limit")
+)
+
+type organizationKey struct{}
+
+// WithOrganization scopes every repository call made with the context to the organization
+func WithOrganization(ctx context.Context, organizationId uint64) context.Context {
+	return context.WithValue(ctx, organizationKey{}, organizationId)
+}
+
+// organization returns the organization of the context, it's zero when there's none
+// which matches nothing, so the calls without any organization can't leak any data.
+func organization(ctx context.Context) uint64 {
+	organizationId, _ := ctx.Value(organizationKey{}).(uint64)
+	return organizationId
+}
+
+// limited translates the violations of the organization limits into their errors
+func limited(err error) error {
+	var rdbmsErr *rdbms.Error
+	if !errors.As(err, &rdbmsErr) {
+		return err
+	}
+
+	switch rdbmsErr.Constraint {
+	case "organizations_users_limit":
+		return ErrUsersLimitExceeded
+	case "organizations_contacts_limit":
+		return ErrContactsLimitExceeded
+	default:
+		return err
+	}
+}
+
+const QueryCreateOrganization = `
+INSERT INTO organizations(slug, name, max_users, max_contacts) VALUES($1, $2, $3, $4)
+RETURNING id, created_at;`
+
+func (r *repository) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	in := []any{org.Slug, org.Name, org.MaxUsers, org.MaxContacts}
+	out := []any{&org.Id, &org.CreatedAt}
+	if err := r.rdbms.QueryRow(ctx, QueryCreateOrganization, in, out); err != nil {
+		r.logger.Error("Error inserting organization", zap.String("slug", org.Slug), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+const organizationColumns = `id, slug, name, max_users, max_contacts, users_count, contacts_count, created_at`
+
+const QueryGetOrganizationBySlug = `
+SELECT ` + organizationColumns + `
+FROM organizations
+WHERE slug=$1;`
+
+func (r *repository) GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	org := &models.Organization{}
+	out := []any{
+		&org.Id, &org.Slug, &org.Name, &org.MaxUsers, &org.MaxContacts,
+		&org.UsersCount, &org.ContactsCount, &org.CreatedAt,
+	}
+	if err := r.rdbms.QueryRow(ctx, QueryGetOrganizationBySlug, []any{slug}, out); err != nil {
+		if !errors.Is(err, rdbms.ErrNotFound) {
+			r.logger.Error("Error get organization by slug", zap.String("slug", slug), zap.Error(err))
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+const QueryGetOrganizations = `
+SELECT ` + organizationColumns + `
+FROM organizations
+ORDER BY slug;`
+
+func (r *repository) GetOrganizations(ctx context.Context) ([]models.Organization, error) {
+	orgs, err := rdbms.Collect(ctx, r.rdbms, QueryGetOrganizations, []any{}, func(row rdbms.Row, org *models.Organization) error {
+		return row.Scan(
+			&org.Id, &org.Slug, &org.Name, &org.MaxUsers, &org.MaxContacts,
+			&org.UsersCount, &org.ContactsCount, &org.CreatedAt,
+		)
+	})
+	if err != nil {
+		r.logger.Error("Error query organizations", zap.Error(err))
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// lowering a limit below the current usage only prevents the further creations
+const QueryUpdateOrganization = `
+UPDATE organizations
+SET name=$1, max_users=$2, max_contacts=$3
+WHERE id=$4
+RETURNING id;`
+
+func (r *repository) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	in := []any{org.Name, org.MaxUsers, org.MaxContacts, org.Id}
+	out := []any{&org.Id}
+	if err := r.rdbms.QueryRow(ctx, QueryUpdateOrganization, in, out); err != nil {
+		r.logger.Error("Error updating organization", zap.Uint64("organization-id", org.Id), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -1,81 +1,121 @@
 package repository
 
 import (
-	"embed"
+	"context"
 	"fmt"
-	"io/fs"
-	"strings"
+	"time"
 
 	"github.com/mohammadne/phone-book/internal/models"
 	"github.com/mohammadne/phone-book/pkg/rdbms"
-	"github.com/mohammadne/phone-book/pkg/utils"
 	"go.uber.org/zap"
 )
 
 type Repository interface {
-	Migrate(models.Migrate) error
-
-	CreateUser(user *models.User) error
-	GetUserByEmail(email string) (*models.User, error)
-	GetUserByEmailAndPassword(email, password string) (*models.User, error)
-
-	CreateContact(userId uint64, contect *models.Contact) error
-	GetContactById(userId, contactId uint64) (*models.Contact, error)
-	UpdateContact(userId uint64, contact *models.Contact) error
-	DeleteContact(userId, contactId uint64) error
-	GetContacts(userId uint64, encryptedCursor, search string, limit int) ([]models.Contact, string, error)
+	// Migrate applies the given number of pending migrations (up) or reverts the given number
+	// of applied ones (down), all of them are affected when steps isn't positive.
+	Migrate(ctx context.Context, direction models.Migrate, steps int) error
+	// MigrateTo applies or reverts the migrations until the given version is the latest applied one
+	MigrateTo(ctx context.Context, version uint64) error
+	Migrations(ctx context.Context) ([]models.Migration, error)
+	PlanMigrate(ctx context.Context, direction models.Migrate, steps int) ([]models.MigrationStep, error)
+	PlanMigrateTo(ctx context.Context, version uint64) ([]models.MigrationStep, error)
+
+	// the organizations aren't scoped, all of the other calls only see the data of the
+	// organization given by WithOrganization (except purging, which is a background job)
+	CreateOrganization(ctx context.Context, org *models.Organization) error
+	GetOrganizationBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	GetOrganizations(ctx context.Context) ([]models.Organization, error)
+	UpdateOrganization(ctx context.Context, org *models.Organization) error
+
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByEmailAndPassword(ctx context.Context, email, password string) (*models.User, error)
+
+	CreateContact(ctx context.Context, userId uint64, contect *models.Contact) error
+	GetContactById(ctx context.Context, userId, contactId uint64) (*models.Contact, error)
+	UpdateContact(ctx context.Context, userId uint64, contact *models.Contact, version uint64) error
+	DeleteContact(ctx context.Context, userId, contactId, version uint64) error
+	RestoreContact(ctx context.Context, userId, contactId uint64) error
+	BatchContacts(ctx context.Context, userId uint64, operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error)
+	PurgeContacts(ctx context.Context, retention time.Duration, limit int) ([]models.Contact, error)
+	GetRevisions(ctx context.Context, userId, contactId, before uint64, limit int) ([]models.Revision, error)
+	RevertContact(ctx context.Context, userId, contactId, revisionId uint64) error
+	GetContacts(ctx context.Context, userId uint64, query *models.ContactsQuery) (*models.ContactsPage, error)
+	SetContactFavorite(ctx context.Context, userId, contactId uint64, favorite bool) error
+	UseContact(ctx context.Context, userId, contactId uint64) error
+	SetContactPhoto(ctx context.Context, userId, contactId uint64, photo string) error
+
+	CreateTag(ctx context.Context, userId uint64, tag *models.Tag) error
+	GetTagById(ctx context.Context, userId, tagId uint64) (*models.Tag, error)
+	GetTags(ctx context.Context, userId uint64) ([]models.Tag, error)
+	UpdateTag(ctx context.Context, userId uint64, tag *models.Tag) error
+	DeleteTag(ctx context.Context, userId, tagId uint64) error
+	TagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error
+	UntagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error
+
+	// Close stops the background work of the repository and releases its connections
+	Close() error
 }
 
 type repository struct {
-	logger *zap.Logger
-	config *Config
-	rdbms  rdbms.RDBMS
+	logger  *zap.Logger
+	config  *Config
+	rdbms   rdbms.RDBMS
+	counter *counter
+	writers *writers
+
+	// bound to a transaction, whose owner reports the changes once it has been committed
+	inTx bool
 }
 
 func New(logger *zap.Logger, cfg *Config, rdbms rdbms.RDBMS) Repository {
 	r := &repository{logger: logger, config: cfg, rdbms: rdbms}
+	r.counter = newCounter(cfg.TotalTTL, cfg.MaxTotals)
+	r.writers = newWriters(cfg.WritersTTL)
 
 	return r
 }
 
-//go:embed migrations
-var migrations embed.FS
-
-func (r *repository) Migrate(direction models.Migrate) error {
-	files, err := fs.ReadDir(migrations, "migrations")
-	if err != nil {
-		return fmt.Errorf("Error reading migrations directory:\n%v", err)
-	}
+func (r *repository) Close() error {
+	return r.rdbms.Close()
+}
 
-	result := make([]string, 0, len(files)/2)
+// reader returns where to run the reads of the user, the replicas are only used
+// once they've replayed the latest write of the user.
+func (r *repository) reader(ctx context.Context, userId uint64) rdbms.RDBMS {
+	return r.rdbms.Replica(r.writers.since(ctx, userId))
+}
 
-	for _, file := range files {
-		splits := strings.Split(file.Name(), ".")
-		if splits[1] == string(direction) {
-			result = append(result, file.Name())
-		}
+// changed must be called after every change of the user's contacts, it drops the cached
+// totals and keeps the following reads of the user away from the lagging replicas.
+func (r *repository) changed(ctx context.Context, userId uint64) {
+	if r.inTx {
+		return
 	}
+	r.counter.invalidate(userId)
+	r.writers.wrote(ctx, userId)
+}
 
-	result = utils.Sort(result)
-
-	for index := 0; index < len(result); index++ {
-		file := "migrations/"
-
-		if direction == models.Up {
-			file += result[index]
-		} else {
-			file += result[len(result)-index-1]
-		}
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory" // volatile, meant for tests and demos
+	DriverSQLite   = "sqlite" // single process deployments without a database server, see SQLiteConfig
+)
 
-		data, err := fs.ReadFile(migrations, file)
+// Open creates the repository of the configured driver, the rdbms is only connected for postgres
+func Open(logger *zap.Logger, cfg *Config, rdbmsCfg *rdbms.Config) (Repository, error) {
+	switch cfg.Driver {
+	case DriverPostgres:
+		db, err := rdbms.New(rdbmsCfg)
 		if err != nil {
-			return fmt.Errorf("Error reading migration file: %s\n%v", file, err)
-		}
-
-		if err := r.rdbms.Execute(string(data), []any{}); err != nil {
-			return fmt.Errorf("Error migrating the file: %s\n%v", file, err)
+			return nil, err
 		}
+		return New(logger, cfg, db), nil
+	case DriverMemory:
+		return NewMemory(logger, cfg), nil
+	case DriverSQLite:
+		return NewSQLite(logger, cfg)
+	default:
+		return nil, fmt.Errorf("Error unknown repository driver: %s", cfg.Driver)
 	}
-
-	return nil
 }
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+// withRevision wraps a statement which changes a single contact, so the new state of
+// the contact is appended to its revisions by the very same (atomic) statement.
+// The statement shouldn't have any RETURNING clause, the contact id, its new version
+// and its update time are returned instead.
+func withRevision(operation models.Operation, statement string) string {
+	return `
+WITH changed AS (` + statement + `
+	RETURNING contacts.id, contacts.version, contacts.name, contacts.phones, contacts.description, contacts.updated_at
+), revision AS (
+	INSERT INTO contact_revisions(contact_id, version, operation, name, phones, description)
+	SELECT id, version, '` + string(operation) + `', name, phones, description FROM changed
+)
+SELECT id, version, updated_at FROM changed;`
+}
+
+const QueryGetRevisions = `
+SELECT contact_revisions.id, contact_revisions.version, operation, contact_revisions.name, contact_revisions.phones, 
+	COALESCE(contact_revisions.description, '') AS description, contact_revisions.created_at
+FROM contact_revisions
+JOIN contacts ON contacts.id = contact_revisions.contact_id
+WHERE 
+	contacts.user_id=$1 AND 
+	contacts.id=$2 AND 
+	contacts.organization_id=$5 AND 
+	($3 = 0 OR contact_revisions.id < $3)
+ORDER BY contact_revisions.id DESC
+FETCH NEXT $4 ROWS ONLY;`
+
+// GetRevisions returns the latest revisions of the contact which are older than the
+// given revision (or the latest ones if it's zero) along with their field-level diffs.
+func (r *repository) GetRevisions(ctx context.Context, userId, contactId, before uint64, limit int) ([]models.Revision, error) {
+	if limit < r.config.Limit.Min {
+		limit = r.config.Limit.Min
+	} else if limit > r.config.Limit.Max {
+		limit = r.config.Limit.Max
+	}
+
+	// fetch one extra revision to diff the oldest one against
+	in := []any{userId, contactId, before, limit + 1, organization(ctx)}
+	revisions, err := rdbms.CollectStructs[models.Revision](ctx, r.reader(ctx, userId), QueryGetRevisions, in)
+	if err != nil {
+		r.logger.Error("Error query revisions", zap.Uint64("contact-id", contactId), zap.Error(err))
+		return nil, err
+	}
+
+	for index := range revisions {
+		if index+1 < len(revisions) {
+			revisions[index].Diff(&revisions[index+1])
+		} else {
+			revisions[index].Diff(nil)
+		}
+	}
+
+	if len(revisions) > limit {
+		revisions = revisions[:limit]
+	}
+
+	return revisions, nil
+}
+
+var QueryRevertContact = withRevision(models.OperationRevert, `
+UPDATE contacts 
+SET 
+	name=contact_revisions.name, phones=contact_revisions.phones, description=contact_revisions.description, 
+	version=contacts.version+1 
+FROM contact_revisions 
+WHERE 
+	contacts.user_id=$1 AND 
+	contacts.id=$2 AND 
+	contacts.organization_id=$4 AND 
+	contacts.deleted_at IS NULL AND 
+	contact_revisions.id=$3 AND 
+	contact_revisions.contact_id = contacts.id`)
+
+// RevertContact restores name, phones and description of the contact from the given revision
+func (r *repository) RevertContact(ctx context.Context, userId, contactId, revisionId uint64) error {
+	var version uint64
+	in := []any{userId, contactId, revisionId, organization(ctx)}
+	out := []any{&contactId, &version, new(time.Time)}
+	if err := r.rdbms.QueryRow(ctx, QueryRevertContact, in, out); err != nil {
+		r.logger.Error("Error reverting contact", zap.Uint64("contact-id", contactId), zap.Uint64("revision-id", revisionId), zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mohammadne/phone-book/internal/models"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are the versions of the schema in order, the version of a database is kept by
+// its user_version pragma and the newer ones are applied on startup. They're only appended to.
+var sqliteMigrations = []string{
+	// 1: the initial schema
+	`
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY,
+	email TEXT NOT NULL,
+	password TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS contacts (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	phones TEXT NOT NULL,
+	description TEXT NOT NULL,
+	favorite INTEGER NOT NULL,
+	usage_count INTEGER NOT NULL,
+	last_used_at TEXT,
+	photo TEXT NOT NULL,
+	deleted_at TEXT,
+	version INTEGER NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	color TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS contact_tags (
+	contact_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (contact_id, tag_id)
+);
+CREATE TABLE IF NOT EXISTS contact_revisions (
+	id INTEGER PRIMARY KEY,
+	contact_id INTEGER NOT NULL,
+	version INTEGER NOT NULL,
+	operation TEXT NOT NULL,
+	name TEXT NOT NULL,
+	phones TEXT NOT NULL,
+	description TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS sequences (
+	name TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);`,
+
+	// 2: the organizations, the existing users belong to the default one
+	`
+CREATE TABLE organizations (
+	id INTEGER PRIMARY KEY,
+	slug TEXT NOT NULL,
+	name TEXT NOT NULL,
+	max_users INTEGER,
+	max_contacts INTEGER,
+	users_count INTEGER NOT NULL,
+	contacts_count INTEGER NOT NULL,
+	created_at TEXT NOT NULL
+);
+ALTER TABLE users ADD COLUMN organization_id INTEGER NOT NULL DEFAULT 1;
+INSERT INTO organizations(id, slug, name, users_count, contacts_count, created_at)
+VALUES(1, 'default', 'Default', (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM contacts),
+	strftime('%Y-%m-%dT%H:%M:%fZ', 'now'));
+INSERT OR REPLACE INTO sequences(name, value) VALUES('organizations', 1);`,
+}
+
+// sqlite is the journal of the SQLite backend, which is the memory backend writing every change
+// through into a SQLite database and loading all of the rows back on startup. The database is
+// owned by a single process, so several instances can't share it.
+type sqlite struct {
+	db *sql.DB
+}
+
+func NewSQLite(logger *zap.Logger, cfg *Config) (Repository, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.SQLite.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("Error creating sqlite directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", cfg.SQLite.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening sqlite database: %w", err)
+	}
+
+	// the writes are serialized by the memory backend anyway
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	journal := &sqlite{db: db}
+	if err := journal.migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error migrating sqlite schema: %w", err)
+	}
+
+	state, err := journal.load(ctx)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Error loading sqlite database: %w", err)
+	}
+
+	return &memory{logger: logger, config: cfg, state: state, journal: journal}, nil
+}
+
+func (s *sqlite) write(ctx context.Context, changes []change) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		if err := s.apply(ctx, tx, change); err != nil {
+			return fmt.Errorf("Error writing %s into sqlite: %w", change.table, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// migrate applies the versions of the schema which the database doesn't have yet, each one
+// along with its version in a transaction, so a failed version is retried on the next startup.
+func (s *sqlite) migrate(ctx context.Context) error {
+	version, err := s.version(ctx)
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(sqliteMigrations); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("version %d: %w", version+1, err)
+		} else if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("version %d: %w", version+1, err)
+		} else if err := tx.Commit(); err != nil {
+			return fmt.Errorf("version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// version returns the version of the schema, the databases created before the versions were
+// kept have the latest one if their users belong to organizations and the first one otherwise.
+func (s *sqlite) version(ctx context.Context) (int, error) {
+	var version int
+	if err := s.db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, err
+	} else if version != 0 {
+		return version, nil
+	}
+
+	query := `SELECT (SELECT COUNT(*) FROM pragma_table_info('users')),
+	(SELECT COUNT(*) FROM pragma_table_info('users') WHERE name='organization_id')`
+	var columns, organizations int
+	if err := s.db.QueryRowContext(ctx, query).Scan(&columns, &organizations); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case organizations != 0:
+		version = 2
+	case columns != 0:
+		version = 1
+	default:
+		return 0, nil
+	}
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version))
+	return version, err
+}
+
+func (s *sqlite) close() error {
+	return s.db.Close()
+}
+
+func (s *sqlite) apply(ctx context.Context, tx *sql.Tx, change change) error {
+	var query string
+	var in []any
+
+	switch row := change.row.(type) {
+	case nil:
+		if change.table == tableContactTags {
+			pair := change.key.([2]uint64)
+			query, in = `DELETE FROM contact_tags WHERE contact_id=? AND tag_id=?`, []any{pair[0], pair[1]}
+		} else if change.table == tableSequences {
+			query, in = `DELETE FROM sequences WHERE name=?`, []any{change.key}
+		} else {
+			query, in = `DELETE FROM `+change.table+` WHERE id=?`, []any{change.key}
+		}
+	case bool:
+		pair := change.key.([2]uint64)
+		query, in = `INSERT OR IGNORE INTO contact_tags(contact_id, tag_id) VALUES(?, ?)`, []any{pair[0], pair[1]}
+	case uint64:
+		query, in = `INSERT OR REPLACE INTO sequences(name, value) VALUES(?, ?)`, []any{change.key, row}
+	case *models.Organization:
+		query = `
+INSERT OR REPLACE INTO organizations(id, slug, name, max_users, max_contacts, users_count, contacts_count, created_at)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+		in = []any{row.Id, row.Slug, row.Name, row.MaxUsers, row.MaxContacts, row.UsersCount, row.ContactsCount,
+			formatTime(&row.CreatedAt)}
+	case *models.User:
+		// the users carry their time as a text already, it's normalized like the other times
+		createdAt, err := time.Parse(time.RFC3339Nano, row.CreatedAt)
+		if err != nil {
+			return err
+		}
+		query = `INSERT OR REPLACE INTO users(id, organization_id, email, password, created_at) VALUES(?, ?, ?, ?, ?)`
+		in = []any{row.Id, row.OrganizationId, row.Email, row.Password, formatTime(&createdAt)}
+	case *memoryTag:
+		query = `INSERT OR REPLACE INTO tags(id, user_id, name, color) VALUES(?, ?, ?, ?)`
+		in = []any{row.Id, row.UserId, row.Name, row.Color}
+	case *memoryContact:
+		phones, err := json.Marshal(row.Phones)
+		if err != nil {
+			return err
+		}
+		query = `
+INSERT OR REPLACE INTO contacts(id, user_id, name, phones, description, favorite, usage_count,
+	last_used_at, photo, deleted_at, version, created_at, updated_at)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		in = []any{row.Id, row.UserId, row.Name, string(phones), row.Description, row.Favorite, row.UsageCount,
+			formatTime(row.LastUsedAt), row.Photo, formatTime(row.DeletedAt), row.Version,
+			formatTime(&row.CreatedAt), formatTime(&row.UpdatedAt)}
+	case *memoryRevision:
+		phones, err := json.Marshal(row.Phones)
+		if err != nil {
+			return err
+		}
+		query = `
+INSERT OR REPLACE INTO contact_revisions(id, contact_id, version, operation, name, phones, description, created_at)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?)`
+		in = []any{row.Id, row.ContactId, row.Version, string(row.Operation), row.Name, string(phones),
+			row.Description, formatTime(&row.CreatedAt)}
+	default:
+		return fmt.Errorf("unknown row of type %T", row)
+	}
+
+	_, err := tx.ExecContext(ctx, query, in...)
+	return err
+}
+
+// load reads all of the rows into a new memory state
+func (s *sqlite) load(ctx context.Context) (*memoryState, error) {
+	state := newMemoryState()
+
+	query := `SELECT id, slug, name, max_users, max_contacts, users_count, contacts_count, created_at FROM organizations`
+	err := s.each(ctx, query, func(rows *sql.Rows) error {
+		org := &models.Organization{}
+		var createdAt string
+		err := rows.Scan(&org.Id, &org.Slug, &org.Name, &org.MaxUsers, &org.MaxContacts, &org.UsersCount,
+			&org.ContactsCount, &createdAt)
+		if err != nil {
+			return err
+		} else if org.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return err
+		}
+
+		state.organizations[org.Id] = org
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(ctx, `SELECT id, organization_id, email, password, created_at FROM users`, func(rows *sql.Rows) error {
+		user := &models.User{}
+		var createdAt string
+		if err := rows.Scan(&user.Id, &user.OrganizationId, &user.Email, &user.Password, &createdAt); err != nil {
+			return err
+		}
+
+		parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return err
+		}
+		user.CreatedAt = parsed.Format(time.RFC3339Nano)
+
+		state.users[user.Id] = user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+SELECT id, user_id, name, phones, description, favorite, usage_count, last_used_at, photo, deleted_at,
+	version, created_at, updated_at
+FROM contacts`
+	err = s.each(ctx, query, func(rows *sql.Rows) error {
+		contact := &memoryContact{}
+		var phones, createdAt, updatedAt string
+		var lastUsedAt, deletedAt sql.NullString
+		err := rows.Scan(&contact.Id, &contact.UserId, &contact.Name, &phones, &contact.Description,
+			&contact.Favorite, &contact.UsageCount, &lastUsedAt, &contact.Photo, &deletedAt,
+			&contact.Version, &createdAt, &updatedAt)
+		if err != nil {
+			return err
+		} else if err := json.Unmarshal([]byte(phones), &contact.Phones); err != nil {
+			return err
+		}
+
+		if contact.LastUsedAt, err = parseTime(lastUsedAt); err != nil {
+			return err
+		} else if contact.DeletedAt, err = parseTime(deletedAt); err != nil {
+			return err
+		} else if contact.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return err
+		} else if contact.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+			return err
+		}
+
+		state.contacts[contact.Id] = contact
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(ctx, `SELECT id, user_id, name, color FROM tags`, func(rows *sql.Rows) error {
+		tag := &memoryTag{}
+		if err := rows.Scan(&tag.Id, &tag.UserId, &tag.Name, &tag.Color); err != nil {
+			return err
+		}
+		state.tags[tag.Id] = tag
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(ctx, `SELECT contact_id, tag_id FROM contact_tags`, func(rows *sql.Rows) error {
+		var contactId, tagId uint64
+		if err := rows.Scan(&contactId, &tagId); err != nil {
+			return err
+		}
+		if state.contactTags[contactId] == nil {
+			state.contactTags[contactId] = make(map[uint64]bool)
+		}
+		state.contactTags[contactId][tagId] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `SELECT id, contact_id, version, operation, name, phones, description, created_at FROM contact_revisions`
+	err = s.each(ctx, query, func(rows *sql.Rows) error {
+		revision := &memoryRevision{}
+		var phones, createdAt string
+		err := rows.Scan(&revision.Id, &revision.ContactId, &revision.Version, &revision.Operation,
+			&revision.Name, &phones, &revision.Description, &createdAt)
+		if err != nil {
+			return err
+		} else if err := json.Unmarshal([]byte(phones), &revision.Phones); err != nil {
+			return err
+		} else if revision.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return err
+		}
+
+		state.revisions[revision.Id] = revision
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.each(ctx, `SELECT name, value FROM sequences`, func(rows *sql.Rows) error {
+		var name string
+		var value uint64
+		if err := rows.Scan(&name, &value); err != nil {
+			return err
+		}
+		state.sequences[name] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *sqlite) each(ctx context.Context, query string, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// times are kept as RFC 3339 texts, so the database stays readable
+func formatTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestSQLiteUpgrade opens the databases created by the older schemas, before their versions were kept
+func TestSQLiteUpgrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions int // number of the versions applied without keeping their version
+	}{
+		{"initial schema", 1},
+		{"organizations", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig(DriverSQLite, filepath.Join(t.TempDir(), "phone-book.db"))
+			ctx := context.Background()
+
+			db, err := sql.Open("sqlite", cfg.SQLite.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, migration := range sqliteMigrations[:test.versions] {
+				if _, err := db.ExecContext(ctx, migration); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err = db.ExecContext(ctx, `INSERT INTO users(id, email, password, created_at) VALUES(1, 'old@example.com', 'secret', '2026-01-02T03:04:05Z')`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.Close()
+
+			// the second open finds the version kept by the first one
+			for range []int{1, 2} {
+				repo, err := NewSQLite(zap.NewNop(), cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				user, err := repo.GetUserByEmail(WithOrganization(ctx, 1), "old@example.com")
+				if err != nil {
+					t.Fatal(err)
+				} else if user.Id != 1 || user.OrganizationId != 1 {
+					t.Fatalf("upgraded user is %+v", user)
+				}
+				repo.Close()
+			}
+
+			db, err = sql.Open("sqlite", cfg.SQLite.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var version int
+			if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+				t.Fatal(err)
+			} else if version != len(sqliteMigrations) {
+				t.Fatalf("upgraded database has version %d instead of %d", version, len(sqliteMigrations))
+			}
+		})
+	}
+}
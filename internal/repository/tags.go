@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/mohammadne/phone-book/internal/models"
+	"github.com/mohammadne/phone-book/pkg/rdbms"
+	"go.uber.org/zap"
+)
+
+var ErrTagsLimitExceeded = errors.New("Error maximum number of tags has been reached")
+
+// the user is locked so the concurrent creations count the tags one after another,
+// a plain count before the insert lets all of them pass the limit at once
+const QueryLockUserTags = `
+SELECT id
+FROM users
+WHERE id=$1 AND organization_id=$2
+FOR NO KEY UPDATE;`
+
+const QueryCreateTag = `
+INSERT INTO tags(name, color, user_id, organization_id)
+SELECT $1, $2, $3, $4
+WHERE (SELECT COUNT(*) FROM tags WHERE user_id=$3 AND organization_id=$4) < $5
+RETURNING id;`
+
+func (r *repository) CreateTag(ctx context.Context, userId uint64, tag *models.Tag) error {
+	// each statement has to see the tags committed before the lock is taken, which read committed guarantees
+	opts := &rdbms.TxOptions{Isolation: sql.LevelReadCommitted}
+	err := r.rdbms.WithTxOptions(ctx, opts, func(tx rdbms.RDBMS) error {
+		var id uint64
+		if err := tx.QueryRow(ctx, QueryLockUserTags, []any{userId, organization(ctx)}, []any{&id}); err != nil {
+			r.logger.Error("Error locking the user of the tags", zap.Uint64("user-id", userId), zap.Error(err))
+			return err
+		}
+
+		in := []any{tag.Name, tag.Color, userId, organization(ctx), r.config.MaxTags}
+		out := []any{&tag.Id}
+		if err := tx.QueryRow(ctx, QueryCreateTag, in, out); errors.Is(err, rdbms.ErrNotFound) {
+			return ErrTagsLimitExceeded
+		} else if err != nil {
+			r.logger.Error("Error inserting tag", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.writers.wrote(ctx, userId)
+	return nil
+}
+
+const QueryGetTagById = `
+SELECT name, color
+FROM tags
+WHERE user_id=$1 AND id=$2 AND organization_id=$3;`
+
+func (r *repository) GetTagById(ctx context.Context, userId, tagId uint64) (*models.Tag, error) {
+	tag := models.Tag{Id: tagId}
+
+	in := []any{userId, tagId, organization(ctx)}
+	out := []any{&tag.Name, &tag.Color}
+	if err := r.reader(ctx, userId).QueryRow(ctx, QueryGetTagById, in, out); err != nil {
+		r.logger.Error("Error get tag by id", zap.Error(err))
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+const QueryGetTags = `
+SELECT id, name, color
+FROM tags
+WHERE user_id=$1 AND organization_id=$3
+ORDER BY name
+FETCH NEXT $2 ROWS ONLY;`
+
+func (r *repository) GetTags(ctx context.Context, userId uint64) ([]models.Tag, error) {
+	in := []any{userId, r.config.MaxTags, organization(ctx)}
+	tags, err := rdbms.CollectStructs[models.Tag](ctx, r.reader(ctx, userId), QueryGetTags, in)
+	if err != nil {
+		r.logger.Error("Error query tags", zap.Error(err))
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// the tag is a part of its contacts, so their version is incremented too
+const QueryUpdateTag = `
+WITH updated AS (
+	UPDATE tags 
+	SET name=$1, color=$2 
+	WHERE user_id=$3 AND id=$4 AND organization_id=$5
+	RETURNING id
+), bumped AS (
+	UPDATE contacts 
+	SET version=version+1 
+	WHERE id IN (SELECT contact_id FROM contact_tags WHERE tag_id IN (SELECT id FROM updated))
+)
+SELECT id FROM updated;`
+
+func (r *repository) UpdateTag(ctx context.Context, userId uint64, tag *models.Tag) error {
+	in := []any{tag.Name, tag.Color, userId, tag.Id, organization(ctx)}
+	out := []any{&tag.Id}
+	if err := r.rdbms.QueryRow(ctx, QueryUpdateTag, in, out); err != nil {
+		r.logger.Error("Error updating tag", zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+const QueryDeleteTag = `
+WITH deleted AS (
+	DELETE FROM tags 
+	WHERE user_id=$1 AND id=$2 AND organization_id=$3
+	RETURNING id
+), bumped AS (
+	UPDATE contacts 
+	SET version=version+1 
+	WHERE id IN (SELECT contact_id FROM contact_tags WHERE tag_id IN (SELECT id FROM deleted))
+)
+SELECT id FROM deleted;`
+
+func (r *repository) DeleteTag(ctx context.Context, userId, tagId uint64) error {
+	in := []any{userId, tagId, organization(ctx)}
+	out := []any{&tagId}
+	if err := r.rdbms.QueryRow(ctx, QueryDeleteTag, in, out); err != nil {
+		r.logger.Error("Error deleting tag", zap.Uint64("user-id", userId), zap.Uint64("tag-id", tagId), zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+// only the contacts and the tag owned by the user are affected,
+// the ids of other users are silently ignored.
+const QueryTagContacts = `
+WITH tagged AS (
+	INSERT INTO contact_tags(contact_id, tag_id)
+	SELECT contacts.id, tags.id
+	FROM contacts, tags
+	WHERE 
+		tags.user_id=$1 AND 
+		tags.id=$2 AND 
+		tags.organization_id=$4 AND 
+		contacts.user_id=$1 AND 
+		contacts.organization_id=$4 AND 
+		contacts.deleted_at IS NULL AND 
+		contacts.id = ANY($3)
+	ON CONFLICT DO NOTHING
+	RETURNING contact_id
+)
+UPDATE contacts 
+SET version=version+1 
+WHERE id IN (SELECT contact_id FROM tagged);`
+
+func (r *repository) TagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error {
+	in := []any{userId, tagId, pq.Array(toInt64s(contactIds)), organization(ctx)}
+	if err := r.rdbms.Execute(ctx, QueryTagContacts, in); err != nil {
+		r.logger.Error("Error tagging contacts", zap.Uint64("tag-id", tagId), zap.Uint64s("contact-ids", contactIds), zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+const QueryUntagContacts = `
+WITH untagged AS (
+	DELETE FROM contact_tags
+	USING tags
+	WHERE 
+		tags.id = contact_tags.tag_id AND 
+		tags.user_id=$1 AND 
+		tags.id=$2 AND 
+		tags.organization_id=$4 AND 
+		contact_tags.contact_id = ANY($3)
+	RETURNING contact_tags.contact_id
+)
+UPDATE contacts 
+SET version=version+1 
+WHERE id IN (SELECT contact_id FROM untagged);`
+
+func (r *repository) UntagContacts(ctx context.Context, userId, tagId uint64, contactIds []uint64) error {
+	in := []any{userId, tagId, pq.Array(toInt64s(contactIds)), organization(ctx)}
+	if err := r.rdbms.Execute(ctx, QueryUntagContacts, in); err != nil {
+		r.logger.Error("Error untagging contacts", zap.Uint64("tag-id", tagId), zap.Uint64s("contact-ids", contactIds), zap.Error(err))
+		return err
+	}
+	r.changed(ctx, userId)
+	return nil
+}
+
+func toInt64s(ids []uint64) []int64 {
+	result := make([]int64, len(ids))
+	for index, id := range ids {
+		result[index] = int64(id)
+	}
+	return result
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"errors"
 
 	"github.com/mohammadne/phone-book/internal/models"
@@ -9,19 +10,20 @@ import (
 )
 
 const QueryCreateUser = `
-INSERT INTO users(email, password) VALUES($1, $2) 
+INSERT INTO users(email, password, organization_id) VALUES($1, $2, $3) 
 RETURNING id;`
 
-func (r *repository) CreateUser(user *models.User) error {
+func (r *repository) CreateUser(ctx context.Context, user *models.User) error {
 	if len(user.Email) == 0 || len(user.Password) == 0 {
 		return errors.New("Insufficient information for user")
 	}
 
-	in := []any{user.Email, user.Password}
+	user.OrganizationId = organization(ctx)
+	in := []any{user.Email, user.Password, user.OrganizationId}
 	out := []any{&user.Id}
-	if err := r.rdbms.QueryRow(QueryCreateUser, in, out); err != nil {
+	if err := r.rdbms.QueryRow(ctx, QueryCreateUser, in, out); err != nil {
 		r.logger.Error("Error inserting author", zap.Error(err))
-		return err
+		return limited(err)
 	}
 
 	return nil
@@ -33,6 +35,7 @@ FROM users
 JOIN contacts ON users.id = contacts.user_id
 WHERE 
 	users.id=$1 AND 
+	users.organization_id=$5 AND 
 	contacts.id > $2 AND 
 	contacts.name LIKE '%' || $3 || '%'
 ORDER BY contacts.id
@@ -41,15 +44,16 @@ FETCH NEXT $4 ROWS ONLY;`
 const QueryGetUserByEmail = `
 SELECT id, password, created_at
 FROM users
-WHERE email=$1;`
+WHERE organization_id=$2 AND LOWER(email)=LOWER($1);`
 
-func (r *repository) GetUserByEmail(email string) (*models.User, error) {
-	user := &models.User{Email: email}
+// the users are always read from the primary, signing in right after signing up must find them
+func (r *repository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	user := &models.User{Email: email, OrganizationId: organization(ctx)}
 
-	in := []interface{}{email}
+	in := []interface{}{email, user.OrganizationId}
 	out := []interface{}{&user.Id, &user.Password, &user.CreatedAt}
-	if err := r.rdbms.QueryRow(QueryGetUserByEmail, in, out); err != nil {
-		if err.Error() == rdbms.ErrNotFound {
+	if err := r.rdbms.QueryRow(ctx, QueryGetUserByEmail, in, out); err != nil {
+		if errors.Is(err, rdbms.ErrNotFound) {
 			return nil, err
 		}
 
@@ -63,14 +67,14 @@ func (r *repository) GetUserByEmail(email string) (*models.User, error) {
 const QueryGetUserByEmailAndPassword = `
 SELECT id, created_at 
 FROM users 
-WHERE email=$1 AND password=$2;`
+WHERE organization_id=$3 AND LOWER(email)=LOWER($1) AND password=$2;`
 
-func (r *repository) GetUserByEmailAndPassword(email, password string) (*models.User, error) {
-	user := &models.User{Email: email, Password: password}
+func (r *repository) GetUserByEmailAndPassword(ctx context.Context, email, password string) (*models.User, error) {
+	user := &models.User{Email: email, Password: password, OrganizationId: organization(ctx)}
 
-	in := []interface{}{email, password}
+	in := []interface{}{email, password, user.OrganizationId}
 	out := []interface{}{&user.Id, &user.CreatedAt}
-	if err := r.rdbms.QueryRow(QueryGetUserByEmailAndPassword, in, out); err != nil {
+	if err := r.rdbms.QueryRow(ctx, QueryGetUserByEmailAndPassword, in, out); err != nil {
 		r.logger.Error("Error find user by email and password", zap.Error(err))
 		return nil, err
 	}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// writers remembers when every user has written for the last time, so their reads are only
+// routed to the replicas which have replayed that write (read-your-writes). The writes older
+// than the ttl are forgotten, the replicas lagging any further aren't used anyway.
+// It only knows about the writes of this instance, the others are carried by the sessions.
+type writers struct {
+	ttl     time.Duration
+	mutex   sync.RWMutex
+	entries map[uint64]time.Time
+	sweptAt time.Time
+}
+
+func newWriters(ttl time.Duration) *writers {
+	return &writers{ttl: ttl, entries: make(map[uint64]time.Time), sweptAt: time.Now()}
+}
+
+// wrote must be called once the write of the user has been committed
+func (w *writers) wrote(ctx context.Context, userId uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := time.Now()
+	w.entries[userId] = now
+
+	if now.Sub(w.sweptAt) > w.ttl {
+		for id, at := range w.entries {
+			if now.Sub(at) > w.ttl {
+				delete(w.entries, id)
+			}
+		}
+		w.sweptAt = now
+	}
+
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		session.wrote(now)
+	}
+}
+
+// since returns the time of the user's latest write, known by this instance or given by
+// the session of the context, zero if it's been forgotten
+func (w *writers) since(ctx context.Context, userId uint64) time.Time {
+	w.mutex.RLock()
+	since := w.entries[userId]
+	w.mutex.RUnlock()
+
+	if session, ok := ctx.Value(sessionKey{}).(*Session); ok {
+		if wroteAt := session.WroteAt(); wroteAt.After(since) {
+			since = wroteAt
+		}
+	}
+	return since
+}
+
+type sessionKey struct{}
+
+// Session carries the latest write of a client between the instances, so its reads observe
+// its writes whichever instance has served them. The clocks of the instances are compared,
+// so they're expected to be synchronized way more precisely than the max lag of the replicas.
+type Session struct {
+	mutex   sync.Mutex
+	wroteAt time.Time
+}
+
+// WithSession routes the reads made with the context to the replicas which have replayed the
+// writes committed before wroteAt (as echoed back by the client), the returned session is
+// advanced by the writes made with the context.
+func WithSession(ctx context.Context, wroteAt time.Time) (context.Context, *Session) {
+	session := &Session{wroteAt: wroteAt}
+	return context.WithValue(ctx, sessionKey{}, session), session
+}
+
+// WroteAt returns the time of the latest write of the session
+func (s *Session) WroteAt() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.wroteAt
+}
+
+func (s *Session) wrote(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if at.After(s.wroteAt) {
+		s.wroteAt = at
+	}
+}
@@ -20,6 +20,8 @@ func main() {
 	root.AddCommand(
 		cmd.Server{}.Command(trap),
 		cmd.Migrate{}.Command(trap),
+		cmd.Organization{}.Command(trap),
+		cmd.OpenAPI{}.Command(trap),
 	)
 
 	if err := root.Execute(); err != nil {
@@ -4,17 +4,20 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"errors"
 )
 
+var ErrMalformedCipherText = errors.New("malformed cipher text")
+
 // procedure is as follow:
 //
 // 1. base64 decode
 //
-// 2. decrypt aes in CTR mode
+// 2. open aes in GCM mode (verify + decrypt)
 //
-// 3. remove salt
+// any modification of the cipher text makes the authentication fail.
 func Decrypt(cipherText, secret string) (string, error) {
-	binaryCipherText, err := base64.URLEncoding.DecodeString(cipherText)
+	binaryCipherText, err := base64.RawURLEncoding.DecodeString(cipherText)
 	if err != nil {
 		return "", err
 	}
@@ -27,10 +30,21 @@ func Decrypt(cipherText, secret string) (string, error) {
 		return "", err
 	}
 
-	// Decrpt
-	decryptedText := make([]byte, len(binaryCipherText[aes.BlockSize:]))
-	decryptStream := cipher.NewCTR(block, binaryCipherText[:aes.BlockSize])
-	decryptStream.XORKeyStream(decryptedText, binaryCipherText[aes.BlockSize:])
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(binaryCipherText) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrMalformedCipherText
+	}
+
+	// Decrypt
+	nonce, sealed := binaryCipherText[:aead.NonceSize()], binaryCipherText[aead.NonceSize():]
+	decryptedText, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
 
 	return string(decryptedText), nil
 }
@@ -10,9 +10,9 @@ import (
 
 // procedure is as follow:
 //
-// 1. plainText + salt -> binary format
+// 1. plainText -> binary format
 //
-// 2. encrypt aes in CTR mode
+// 2. seal with aes in GCM mode (encrypt + authenticate)
 //
 // 3. base64 encode
 func Encrypt(plainText, secret string) (string, error) {
@@ -24,19 +24,20 @@ func Encrypt(plainText, secret string) (string, error) {
 		return "", err
 	}
 
-	// The IV (Initialization Vector) need to be unique, but not secure.
-	// Therefore, it's common to include it at the beginning of the cipher text.
-	cipherText := make([]byte, aes.BlockSize+len(binaryText))
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
 
-	// Create IV
-	iv := cipherText[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	// The nonce need to be unique, but not secure.
+	// Therefore, it's common to include it at the beginning of the cipher text.
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(binaryText)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
-	// Encrypt
-	encryptStream := cipher.NewCTR(block, iv)
-	encryptStream.XORKeyStream(cipherText[aes.BlockSize:], binaryText)
+	// Encrypt and append the authentication tag
+	cipherText := aead.Seal(nonce, nonce, binaryText, nil)
 
-	return base64.URLEncoding.EncodeToString(cipherText), nil
+	return base64.RawURLEncoding.EncodeToString(cipherText), nil
 }
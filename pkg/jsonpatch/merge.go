@@ -0,0 +1,41 @@
+package jsonpatch
+
+import "encoding/json"
+
+// MergePatch applies a JSON merge patch (RFC 7396) to the document,
+// null members of the patch remove the target members of the document.
+func MergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes any
+
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, ErrInvalidDocument
+	}
+
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = merge(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
@@ -0,0 +1,64 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// equalJSON compares the documents regardless of the order of their members
+func equalJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("result %s isn't valid json: %v", got, err)
+	} else if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("expectation %s isn't valid json: %v", want, err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("result is %s instead of %s", got, want)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		{"replaces member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"adds member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null removes member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"null of missing member", `{"a":"b"}`, `{"c":null}`, `{"a":"b"}`},
+		{"null removes nested member", `{"a":{"b":"c","d":"e"}}`, `{"a":{"b":null}}`, `{"a":{"d":"e"}}`},
+		{"null inside of new object is dropped", `{}`, `{"a":{"b":null,"c":"d"}}`, `{"a":{"c":"d"}}`},
+		{"empty string isn't null", `{"a":"b"}`, `{"a":""}`, `{"a":""}`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"null items of arrays are kept", `{"a":[1]}`, `{"a":[null]}`, `{"a":[null]}`},
+		{"object replaces scalar", `{"a":"b"}`, `{"a":{"c":"d"}}`, `{"a":{"c":"d"}}`},
+		{"scalar patch replaces document", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"empty patch changes nothing", `{"a":"b"}`, `{}`, `{"a":"b"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(test.document), []byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			equalJSON(t, got, test.want)
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	if _, err := MergePatch([]byte(`{`), []byte(`{}`)); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("invalid document has returned %v", err)
+	} else if _, err := MergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("invalid patch has returned %v", err)
+	}
+}
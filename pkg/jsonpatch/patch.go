@@ -0,0 +1,233 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	ErrInvalidDocument = errors.New("Error invalid json document")
+	ErrInvalidPatch    = errors.New("Error invalid json patch")
+	ErrInvalidPointer  = errors.New("Error invalid json pointer")
+	ErrPathNotFound    = errors.New("Error json pointer path not found")
+	ErrTestFailed      = errors.New("Error json patch test operation failed")
+)
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies a JSON patch (RFC 6902) to the document, the operations are
+// applied in order and the whole patch fails if any of them fails.
+func Apply(document, patch []byte) ([]byte, error) {
+	var target any
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, ErrInvalidDocument
+	}
+
+	var operations []operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	for index, op := range operations {
+		var err error
+		if target, err = apply(target, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", index, op.Op, op.Path, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(document any, op operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+		if len(op.Value) == 0 {
+			return nil, ErrInvalidPatch
+		} else if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, ErrInvalidPatch
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return add(document, path, value)
+	case "remove":
+		document, _, err = remove(document, path)
+		return document, err
+	case "replace":
+		if document, _, err = remove(document, path); err != nil {
+			return nil, err
+		}
+		return add(document, path, value)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			// a value can't be moved into one of its own children
+			if from.contains(path) {
+				return nil, ErrInvalidPatch
+			} else if document, value, err = remove(document, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = get(document, from); err != nil {
+			return nil, err
+		} else {
+			value = clone(value)
+		}
+
+		return add(document, path, value)
+	case "test":
+		current, err := get(document, path)
+		if err != nil {
+			return nil, err
+		} else if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return document, nil
+	default:
+		return nil, ErrInvalidPatch
+	}
+}
+
+func get(document any, path pointer) (any, error) {
+	if len(path) == 0 {
+		return document, nil
+	}
+
+	parent, err := path.parent(document)
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[last]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		return value, nil
+	case []any:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		return node[index], nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+func add(document any, path pointer, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := path.parent(document)
+	if err != nil {
+		return nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return document, nil
+	case []any:
+		index := len(node)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(node)); err != nil {
+				return nil, err
+			}
+		}
+
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return replaceParent(document, path, node)
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+func remove(document any, path pointer) (any, any, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+
+	parent, err := path.parent(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, ErrPathNotFound
+		}
+		delete(node, last)
+		return document, value, nil
+	case []any:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		value := node[index]
+		node = append(node[:index:index], node[index+1:]...)
+		document, err = replaceParent(document, path, node)
+		return document, value, err
+	default:
+		return nil, nil, ErrPathNotFound
+	}
+}
+
+// replaceParent stores the array which has been resized into its own parent
+func replaceParent(document any, path pointer, array []any) (any, error) {
+	parentPath := path[:len(path)-1]
+	if len(parentPath) == 0 {
+		return array, nil
+	}
+
+	grandParent, err := parentPath.parent(document)
+	if err != nil {
+		return nil, err
+	}
+
+	last := parentPath[len(parentPath)-1]
+	switch node := grandParent.(type) {
+	case map[string]any:
+		node[last] = array
+	case []any:
+		index, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = array
+	}
+	return document, nil
+}
+
+func clone(value any) any {
+	data, _ := json.Marshal(value)
+	var result any
+	_ = json.Unmarshal(data, &result)
+	return result
+}
@@ -0,0 +1,111 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		want     string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"add null member", `{"a":1}`, `[{"op":"add","path":"/b","value":null}]`, `{"a":1,"b":null}`},
+		{"add at index 0", `{"a":[1,2]}`, `[{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2]}`},
+		{"add at index len", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`},
+		{"add at index -", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`},
+		{"add into nested array", `{"a":[[1]]}`, `[{"op":"add","path":"/a/0/-","value":2}]`, `{"a":[[1,2]]}`},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove index 0", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`},
+		{"remove last index", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/2"}]`, `{"a":[1,2]}`},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"b"}]`, `{"a":"b"}`},
+		{"replace with null", `{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, `{"a":null}`},
+		{"replace index", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/1","value":3}]`, `{"a":[1,3]}`},
+		{"move member", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`},
+		{"move between arrays", `{"a":[1,2],"b":[]}`, `[{"op":"move","from":"/a/0","path":"/b/-"}]`, `{"a":[2],"b":[1]}`},
+		{"move to itself", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`},
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{"copy is independent", `{"a":{"b":1}}`,
+			`[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`},
+		{"test null", `{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`},
+		{"tilde escaping", `{"a~b":1}`, `[{"op":"replace","path":"/a~0b","value":2}]`, `{"a~b":2}`},
+		{"slash escaping", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escapes are decoded once", `{"~1":1}`, `[{"op":"remove","path":"/~01"}]`, `{}`},
+		{"operations in order", `{}`,
+			`[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1},{"op":"test","path":"/a/0","value":1}]`, `{"a":[1]}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Apply([]byte(test.document), []byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			equalJSON(t, got, test.want)
+		})
+	}
+}
+
+func TestApplyFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		patch    string
+		err      error
+	}{
+		{"invalid document", `{`, `[]`, ErrInvalidDocument},
+		{"invalid patch", `{}`, `{}`, ErrInvalidPatch},
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a"}]`, ErrInvalidPatch},
+		{"add without value", `{}`, `[{"op":"add","path":"/a"}]`, ErrInvalidPatch},
+		{"pointer without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, ErrInvalidPointer},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, ErrPathNotFound},
+		{"add past index len", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, ErrPathNotFound},
+		{"add at negative index", `{"a":[1]}`, `[{"op":"add","path":"/a/-1","value":1}]`, ErrInvalidPointer},
+		{"add at leading zero index", `{"a":[1]}`, `[{"op":"add","path":"/a/01","value":1}]`, ErrInvalidPointer},
+		{"remove missing member", `{}`, `[{"op":"remove","path":"/a"}]`, ErrPathNotFound},
+		{"remove index len", `{"a":[1]}`, `[{"op":"remove","path":"/a/1"}]`, ErrPathNotFound},
+		{"remove index -", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, ErrInvalidPointer},
+		{"replace missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, ErrPathNotFound},
+		{"replace index len", `{"a":[1]}`, `[{"op":"replace","path":"/a/1","value":1}]`, ErrPathNotFound},
+		{"move missing member", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, ErrPathNotFound},
+		{"move into its own child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ErrInvalidPatch},
+		{"copy index len", `{"a":[1]}`, `[{"op":"copy","from":"/a/1","path":"/b"}]`, ErrPathNotFound},
+		{"test different value", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ErrTestFailed},
+		{"test different type", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, ErrTestFailed},
+		{"test missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`, ErrPathNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Apply([]byte(test.document), []byte(test.patch))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("patch has returned %v instead of %v", err, test.err)
+			} else if got != nil {
+				t.Fatalf("failed patch has returned %s", got)
+			}
+		})
+	}
+}
+
+// TestApplyFailedTest checks a failing test operation discards the operations before it
+func TestApplyFailedTest(t *testing.T) {
+	document := []byte(`{"a":{"b":1},"c":[1,2]}`)
+	original := string(document)
+
+	patch := `[
+		{"op":"replace","path":"/a/b","value":2},
+		{"op":"remove","path":"/c/0"},
+		{"op":"test","path":"/a/b","value":1}
+	]`
+	if _, err := Apply(document, []byte(patch)); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("patch has returned %v instead of %v", err, ErrTestFailed)
+	} else if string(document) != original {
+		t.Fatalf("failed patch has changed the document into %s", document)
+	}
+}
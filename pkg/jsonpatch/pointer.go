@@ -0,0 +1,76 @@
+package jsonpatch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// pointer is a parsed JSON pointer (RFC 6901)
+type pointer []string
+
+func parsePointer(path string) (pointer, error) {
+	if len(path) == 0 {
+		return pointer{}, nil
+	} else if path[0] != '/' {
+		return nil, ErrInvalidPointer
+	}
+
+	unescaper := strings.NewReplacer("~1", "/", "~0", "~")
+	tokens := strings.Split(path[1:], "/")
+	for index, token := range tokens {
+		tokens[index] = unescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// contains reports whether the other pointer is a proper descendant of the pointer
+func (p pointer) contains(other pointer) bool {
+	if len(other) <= len(p) {
+		return false
+	}
+	for index, token := range p {
+		if other[index] != token {
+			return false
+		}
+	}
+	return true
+}
+
+// parent returns the container of the last token
+func (p pointer) parent(document any) (any, error) {
+	current := document
+	for _, token := range p[:len(p)-1] {
+		switch node := current.(type) {
+		case map[string]any:
+			child, ok := node[token]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			current = child
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return current, nil
+}
+
+// arrayIndex parses an array index token which can't be greater than max
+func arrayIndex(token string, max int) (int, error) {
+	if len(token) == 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, ErrInvalidPointer
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, ErrInvalidPointer
+	} else if index > max {
+		return 0, ErrPathNotFound
+	}
+	return index, nil
+}
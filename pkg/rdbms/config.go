@@ -1,9 +1,48 @@
 package rdbms
 
+import "time"
+
 type Config struct {
 	Host     string `koanf:"host"`
 	Port     int    `koanf:"port"`
 	Username string `koanf:"username"`
 	Password string `koanf:"password"`
 	Database string `koanf:"database"`
+	Schema   string `koanf:"schema"` // search path of the connections, the server's default if empty
+
+	// read-only standbys of the database, they share the credentials of the primary
+	Replicas []Replica `koanf:"replicas"`
+
+	Pool struct {
+		MaxOpenConns       int           `koanf:"max_open_conns"`
+		MaxIdleConns       int           `koanf:"max_idle_conns"`
+		ConnMaxLifetime    time.Duration `koanf:"conn_max_lifetime"`
+		ConnMaxIdleTime    time.Duration `koanf:"conn_max_idle_time"`
+		StatementCacheSize int           `koanf:"statement_cache_size"` // zero disables the cache
+	} `koanf:"pool"`
+
+	// per-operation statement timeouts, zero means no timeout other than the caller's context
+	Timeout struct {
+		Execute     time.Duration `koanf:"execute"`
+		QueryRow    time.Duration `koanf:"query_row"`
+		Query       time.Duration `koanf:"query"`
+		Transaction time.Duration `koanf:"transaction"`
+	} `koanf:"timeout"`
+
+	Transaction struct {
+		Isolation    string        `koanf:"isolation"`
+		MaxRetries   int           `koanf:"max_retries"`
+		RetryBackoff time.Duration `koanf:"retry_backoff"`
+	} `koanf:"transaction"`
+
+	// routing of the reads between the replicas, they're only used while healthy
+	Routing struct {
+		HealthInterval time.Duration `koanf:"health_interval"`
+		MaxLag         time.Duration `koanf:"max_lag"` // replicas lagging behind any further are skipped
+	} `koanf:"routing"`
+}
+
+type Replica struct {
+	Host string `koanf:"host"`
+	Port int    `koanf:"port"`
 }
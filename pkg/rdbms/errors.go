@@ -0,0 +1,88 @@
+package rdbms
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPrepareStatement = errors.New("Error when tying to prepare statement")
+	ErrNotFound         = errors.New("Error no entry found with given arguments")
+	ErrDuplicate        = errors.New("Error operation canceled due to the duplication entry")
+	ErrForeignKey       = errors.New("Error operation canceled due to a missing referenced entry")
+	ErrCheck            = errors.New("Error operation canceled due to a check constraint")
+	ErrNotNull          = errors.New("Error operation canceled due to a missing required value")
+	ErrSerialization    = errors.New("Error could not serialize access due to concurrent update")
+	ErrDeadlock         = errors.New("Error deadlock detected between concurrent transactions")
+)
+
+// postgres error codes (SQLSTATE) which are mapped into the sentinel errors
+const (
+	codeUniqueViolation      pq.ErrorCode = "23505"
+	codeForeignKeyViolation  pq.ErrorCode = "23503"
+	codeCheckViolation       pq.ErrorCode = "23514"
+	codeNotNullViolation     pq.ErrorCode = "23502"
+	codeSerializationFailure pq.ErrorCode = "40001"
+	codeDeadlockDetected     pq.ErrorCode = "40P01"
+)
+
+var sentinels = map[pq.ErrorCode]error{
+	codeUniqueViolation:      ErrDuplicate,
+	codeForeignKeyViolation:  ErrForeignKey,
+	codeCheckViolation:       ErrCheck,
+	codeNotNullViolation:     ErrNotNull,
+	codeSerializationFailure: ErrSerialization,
+	codeDeadlockDetected:     ErrDeadlock,
+}
+
+// Error is a database error which matches its sentinel error using errors.Is,
+// the underlying *pq.Error is still reachable using errors.As.
+type Error struct {
+	Kind       error  // one of the sentinel errors
+	Code       string // postgres SQLSTATE code
+	Table      string
+	Column     string
+	Constraint string
+	err        error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + "\n" + e.err.Error()
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// classify maps the driver errors into the typed errors of the package,
+// the errors without any known meaning are returned unchanged.
+func classify(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, err: err}
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	kind, ok := sentinels[pqErr.Code]
+	if !ok {
+		return err
+	}
+
+	return &Error{
+		Kind:       kind,
+		Code:       string(pqErr.Code),
+		Table:      pqErr.Table,
+		Column:     pqErr.Column,
+		Constraint: pqErr.Constraint,
+		err:        err,
+	}
+}
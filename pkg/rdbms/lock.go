@@ -0,0 +1,50 @@
+package rdbms
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+var ErrLockTimeout = errors.New("Error timed out waiting for the advisory lock")
+
+// Lock takes the postgres session-level advisory lock of the key on a dedicated connection,
+// it waits for the lock as long as the context is not done. The lock is held until the
+// returned unlock function is called or the session ends (which releases it).
+func (db *rdbms) Lock(ctx context.Context, key int64) (func() error, error) {
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s\n%w", "Error getting a connection for the advisory lock", classify(err))
+	}
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		// a canceled wait may still have taken the lock, so the session isn't reused either
+		discard(conn)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%w\n%v", ErrLockTimeout, err)
+		}
+		return nil, fmt.Errorf("%s\n%w", "Error taking the advisory lock", classify(err))
+	}
+
+	unlock := func() error {
+		defer conn.Close()
+
+		// closing the connection returns its session to the pool along with the lock, so the
+		// connection is discarded when the lock can't be released which ends the session
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			discard(conn)
+			return fmt.Errorf("%s\n%w", "Error releasing the advisory lock", classify(err))
+		}
+		return nil
+	}
+
+	return unlock, nil
+}
+
+// discard closes the connection instead of returning its session to the pool
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
@@ -8,19 +8,64 @@ import (
 )
 
 func New(cfg *Config) (RDBMS, error) {
+	if _, ok := isolationLevels[cfg.Transaction.Isolation]; !ok {
+		return nil, fmt.Errorf("Error unknown transaction isolation level: %s", cfg.Transaction.Isolation)
+	}
+
+	if routing := cfg.Routing; len(cfg.Replicas) != 0 && (routing.HealthInterval <= 0 || routing.MaxLag <= routing.HealthInterval) {
+		return nil, fmt.Errorf("Error replicas health interval must be positive and below the max lag")
+	}
+
+	db, err := open(cfg, cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		return nil, fmt.Errorf("Error ping database:\n%v", err)
+	}
+
+	primary := &rdbms{config: cfg, db: db, statements: newStatements(cfg.Pool.StatementCacheSize)}
+	if len(cfg.Replicas) == 0 {
+		return primary, nil
+	}
+
+	// the replicas aren't pinged, the unreachable ones are just left out of the routing
+	primary.replicas = &replicas{config: cfg, primary: primary}
+	for _, replica := range cfg.Replicas {
+		db, err := open(cfg, replica.Host, replica.Port)
+		if err != nil {
+			return nil, err
+		}
+
+		standby := &rdbms{config: cfg, db: db, statements: newStatements(cfg.Pool.StatementCacheSize)}
+		primary.replicas.members = append(primary.replicas.members, &member{
+			name: fmt.Sprintf("%s:%d", replica.Host, replica.Port), db: standby,
+		})
+	}
+	primary.replicas.start()
+
+	return primary, nil
+}
+
+func open(cfg *Config, host string, port int) (*sql.DB, error) {
 	connString := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Database,
+		host, port, cfg.Username, cfg.Password, cfg.Database,
 	)
+	if len(cfg.Schema) != 0 {
+		connString += " search_path=" + cfg.Schema
+	}
 
 	db, err := sql.Open("postgres", connString)
 	if err != nil {
 		return nil, fmt.Errorf("Error openning connection:\n%v", err)
 	}
 
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("Error ping database:\n%v", err)
-	}
+	db.SetMaxOpenConns(cfg.Pool.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Pool.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.Pool.ConnMaxIdleTime)
 
-	return &rdbms{db: db}, nil
+	return db, nil
 }
@@ -1,90 +1,192 @@
 package rdbms
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"time"
 )
 
 type RDBMS interface {
-	Execute(query string, in []any) error
+	Execute(ctx context.Context, query string, in []any) error
 
-	QueryRow(query string, in []any, out []any) error
+	QueryRow(ctx context.Context, query string, in []any, out []any) error
 
-	Query(query string, in []any, out [][]any) error
+	// Query runs the query and calls the scan function once per produced row in order,
+	// the iteration stops at the first error returned by the function.
+	Query(ctx context.Context, query string, in []any, scan func(row Row) error) error
+
+	// WithTx runs the function inside a transaction with the default options,
+	// see WithTxOptions for the details.
+	WithTx(ctx context.Context, fn func(tx RDBMS) error) error
+
+	// WithTxOptions runs the function inside a transaction which is committed if the function
+	// returns nil and rolled back otherwise. Nested calls run inside a savepoint of the outer one.
+	// The whole transaction is retried on serialization failures and deadlocks, so the
+	// function may run several times and must not have any side effect out of the transaction.
+	WithTxOptions(ctx context.Context, opts *TxOptions, fn func(tx RDBMS) error) error
+
+	// Lock takes an advisory lock which is shared between all the instances using the database,
+	// the returned function releases the lock.
+	Lock(ctx context.Context, key int64) (unlock func() error, err error)
+
+	// Replica returns where to run read-only queries which must observe every write committed
+	// before since: a healthy replica which has replayed them, or the primary if there's none.
+	// Inside of transactions it's the transaction itself.
+	Replica(since time.Time) RDBMS
+
+	// Close stops the health checks of the replicas and closes all of the connections,
+	// it can't be called inside of transactions.
+	Close() error
 }
 
-type rdbms struct {
-	db *sql.DB
+// Row is the current row of a query, it's only valid inside the scan function.
+type Row interface {
+	Scan(dest ...any) error
+	Columns() ([]string, error)
 }
 
-var (
-	ErrPrepareStatement = "Error when tying to prepare statement"
-	ErrNotFound         = "Error no entry found with given arguments"
-	ErrDuplicate        = "Error operation canceled due to the duplication entry"
-)
+type rdbms struct {
+	config     *Config
+	db         *sql.DB
+	tx         *sql.Tx
+	depth      int // nesting depth of the transaction, used to name the savepoints
+	statements *statements
+	replicas   *replicas // nil when there's no replica (and inside transactions)
+}
 
-func (db *rdbms) Execute(query string, in []any) error {
-	stmt, err := db.db.Prepare(query)
+// prepare returns the prepared statement of the query (bound to the transaction if any),
+// the release function has to be called once the statement is not used anymore.
+func (db *rdbms) prepare(ctx context.Context, query string) (*sql.Stmt, func(), error) {
+	stmt, release, err := db.statements.get(ctx, db.db, query)
 	if err != nil {
-		return fmt.Errorf("%s\n%v", ErrPrepareStatement, err)
+		return nil, nil, err
+	}
+
+	if db.tx == nil {
+		return stmt, release, nil
+	}
+
+	txStmt := db.tx.StmtContext(ctx, stmt)
+	return txStmt, func() { txStmt.Close(); release() }, nil
+}
+
+// failed invalidates the cached statement of the query if the error has made it unusable
+func (db *rdbms) failed(query string, err error) {
+	if stale(err) {
+		db.statements.invalidate(query)
+	}
+}
+
+// withTimeout bounds the operation by its configured statement timeout (if any),
+// the operation is canceled in the database once the context is done.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	defer stmt.Close()
+	return context.WithTimeout(ctx, timeout)
+}
 
-	if _, err := stmt.Exec(in...); err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			return errors.New(ErrDuplicate)
+func (db *rdbms) Execute(ctx context.Context, query string, in []any) error {
+	ctx, cancel := withTimeout(ctx, db.config.Timeout.Execute)
+	defer cancel()
+
+	// statements without any parameter are executed using the simple protocol,
+	// so they can have several commands (like migrations) and don't need to be prepared.
+	if len(in) == 0 {
+		var err error
+		if db.tx != nil {
+			_, err = db.tx.ExecContext(ctx, query)
+		} else {
+			_, err = db.db.ExecContext(ctx, query)
 		}
-		return fmt.Errorf("%s\n%v", "error when tying to excute statement", err)
+
+		if err != nil {
+			return fmt.Errorf("%s\n%w", "error when tying to excute statement", classify(err))
+		}
+		return nil
+	}
+
+	stmt, release, err := db.prepare(ctx, query)
+	if err != nil {
+		db.failed(query, err)
+		return fmt.Errorf("%w\n%w", ErrPrepareStatement, classify(err))
+	}
+	defer release()
+
+	if _, err := stmt.ExecContext(ctx, in...); err != nil {
+		db.failed(query, err)
+		return fmt.Errorf("%s\n%w", "error when tying to excute statement", classify(err))
 	}
 
 	return nil
 }
 
-func (db *rdbms) QueryRow(query string, in []any, out []any) error {
-	stmt, err := db.db.Prepare(query)
+func (db *rdbms) QueryRow(ctx context.Context, query string, in []any, out []any) error {
+	ctx, cancel := withTimeout(ctx, db.config.Timeout.QueryRow)
+	defer cancel()
+
+	stmt, release, err := db.prepare(ctx, query)
 	if err != nil {
-		return fmt.Errorf("%s\n%v", ErrPrepareStatement, err)
+		db.failed(query, err)
+		return fmt.Errorf("%w\n%w", ErrPrepareStatement, classify(err))
 	}
-	defer stmt.Close()
+	defer release()
 
-	if err = stmt.QueryRow(in...).Scan(out...); err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			return errors.New(ErrDuplicate)
-		} else if err == sql.ErrNoRows {
-			return errors.New(ErrNotFound)
+	if err = stmt.QueryRowContext(ctx, in...).Scan(out...); err != nil {
+		db.failed(query, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return classify(err)
 		}
-		return fmt.Errorf("%s\n%v", "Error while executing the query or scanning the row", err)
+		return fmt.Errorf("%s\n%w", "Error while executing the query or scanning the row", classify(err))
 	}
 
 	return nil
 }
 
-func (db *rdbms) Query(query string, in []any, out [][]any) error {
-	stmt, err := db.db.Prepare(query)
+func (db *rdbms) Query(ctx context.Context, query string, in []any, scan func(row Row) error) error {
+	ctx, cancel := withTimeout(ctx, db.config.Timeout.Query)
+	defer cancel()
+
+	stmt, release, err := db.prepare(ctx, query)
 	if err != nil {
-		return fmt.Errorf("%s\n%v", ErrPrepareStatement, err)
+		db.failed(query, err)
+		return fmt.Errorf("%w\n%w", ErrPrepareStatement, classify(err))
 	}
-	defer stmt.Close()
+	defer release()
 
-	rows, err := stmt.Query(in...)
+	rows, err := stmt.QueryContext(ctx, in...)
 	if err != nil {
-		return fmt.Errorf("%s\n%v", "Error executing the query", err)
+		db.failed(query, err)
+		return fmt.Errorf("%s\n%w", "Error executing the query", classify(err))
 	}
 	defer rows.Close()
 
-	var index = 0
-	for ; rows.Next(); index++ {
-		if err = rows.Scan(out[index]...); err != nil {
-			return fmt.Errorf("%s\n%v", "Error while scanning the row", err)
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			return fmt.Errorf("%s\n%w", "Error while scanning the row", err)
 		}
 	}
-	out = out[:index+1]
 
 	if err := rows.Err(); err != nil {
-		return fmt.Errorf("%s\n%v", "There's an error in result of the query", err)
+		return fmt.Errorf("%s\n%w", "There's an error in result of the query", classify(err))
 	}
 
 	return nil
 }
+
+func (db *rdbms) Close() error {
+	if db.tx != nil {
+		return errors.New("Error closing the database inside of a transaction")
+	}
+
+	var errs []error
+	if db.replicas != nil {
+		errs = append(errs, db.replicas.close())
+	}
+	if err := db.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("Error closing the database:\n%v", err))
+	}
+	return errors.Join(errs...)
+}
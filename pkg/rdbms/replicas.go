@@ -0,0 +1,278 @@
+package rdbms
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// replicas routes the reads between the healthy standbys of the primary. The WAL position of the
+// primary is sampled on every health check, so the point in time until which a standby has
+// replayed every write is known (without trusting the clocks of the database servers).
+type replicas struct {
+	config  *Config
+	primary *rdbms
+	members []*member
+	next    uint32 // round robin between the members
+
+	mutex   sync.Mutex
+	samples []sample // WAL positions of the primary, the oldest one first
+
+	stop chan struct{} // closed to stop the health checks
+	done chan struct{} // closed once the health checks have stopped
+}
+
+type sample struct {
+	at  time.Time
+	lsn uint64
+}
+
+type member struct {
+	name string
+	db   *rdbms
+
+	mutex      sync.RWMutex
+	healthy    bool
+	replayedAt time.Time // every write committed on the primary before it has been replayed
+}
+
+func (r *replicas) start() {
+	r.stop, r.done = make(chan struct{}), make(chan struct{})
+	r.check()
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.config.Routing.HealthInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.check()
+			}
+		}
+	}()
+}
+
+// close stops the health checks and then closes the members
+func (r *replicas) close() error {
+	close(r.stop)
+	<-r.done
+
+	var errs []error
+	for _, m := range r.members {
+		if err := m.db.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("Error closing replica %s:\n%v", m.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check samples the primary and then probes all of the members concurrently
+func (r *replicas) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Routing.HealthInterval)
+	defer cancel()
+
+	// the sample is taken after its time, so the writes committed before it are included
+	at := time.Now()
+	position, err := lsn(ctx, r.primary.db, "SELECT pg_current_wal_lsn()::text")
+
+	r.mutex.Lock()
+	if err == nil {
+		r.samples = append(r.samples, sample{at: at, lsn: position})
+	}
+	// the members which are only caught up with the older samples are lagging anyway
+	for len(r.samples) > 1 && time.Since(r.samples[0].at) > r.config.Routing.MaxLag {
+		r.samples = r.samples[1:]
+	}
+	samples := append([]sample{}, r.samples...)
+	r.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, m := range r.members {
+		wg.Add(1)
+		go func(m *member) {
+			defer wg.Done()
+			m.probe(ctx, samples)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// probe finds the latest sample of the primary which the member has replayed, a promoted
+// standby has no replay position anymore so it's left out of the routing just like the
+// unreachable ones.
+func (m *member) probe(ctx context.Context, samples []sample) {
+	replayed, err := lsn(ctx, m.db.db, "SELECT COALESCE(pg_last_wal_replay_lsn(), '0/0')::text")
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.healthy = false
+	if err != nil {
+		return
+	}
+
+	for index := len(samples) - 1; index >= 0; index-- {
+		if samples[index].lsn <= replayed {
+			m.healthy, m.replayedAt = true, samples[index].at
+			return
+		}
+	}
+}
+
+func (m *member) down() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.healthy = false
+}
+
+func (m *member) eligible(since time.Time, maxLag time.Duration) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.healthy && m.replayedAt.After(since) && time.Since(m.replayedAt) <= maxLag
+}
+
+// pick returns a member which has replayed the writes committed before since, if any
+func (r *replicas) pick(since time.Time) *member {
+	start := int(atomic.AddUint32(&r.next, 1))
+	for index := range r.members {
+		m := r.members[(start+index)%len(r.members)]
+		if m.eligible(since, r.config.Routing.MaxLag) {
+			return m
+		}
+	}
+	return nil
+}
+
+func (db *rdbms) Replica(since time.Time) RDBMS {
+	if db.tx != nil || db.replicas == nil {
+		return db
+	}
+
+	m := db.replicas.pick(since)
+	if m == nil {
+		return db
+	}
+	return &standby{member: m, primary: db}
+}
+
+// standby runs the reads on a member and fails over to the primary when the member isn't
+// available, unless some rows have been already produced. The writes, transactions and
+// locks always go to the primary.
+type standby struct {
+	member  *member
+	primary *rdbms
+}
+
+func (s *standby) Execute(ctx context.Context, query string, in []any) error {
+	return s.primary.Execute(ctx, query, in)
+}
+
+func (s *standby) QueryRow(ctx context.Context, query string, in []any, out []any) error {
+	err := s.member.db.QueryRow(ctx, query, in, out)
+	if unavailable(err) {
+		s.member.down()
+		return s.primary.QueryRow(ctx, query, in, out)
+	}
+	return err
+}
+
+func (s *standby) Query(ctx context.Context, query string, in []any, scan func(row Row) error) error {
+	scanned := false
+	err := s.member.db.Query(ctx, query, in, func(row Row) error {
+		scanned = true
+		return scan(row)
+	})
+	if !scanned && unavailable(err) {
+		s.member.down()
+		return s.primary.Query(ctx, query, in, scan)
+	}
+	return err
+}
+
+func (s *standby) WithTx(ctx context.Context, fn func(tx RDBMS) error) error {
+	return s.primary.WithTx(ctx, fn)
+}
+
+func (s *standby) WithTxOptions(ctx context.Context, opts *TxOptions, fn func(tx RDBMS) error) error {
+	return s.primary.WithTxOptions(ctx, opts, fn)
+}
+
+func (s *standby) Lock(ctx context.Context, key int64) (func() error, error) {
+	return s.primary.Lock(ctx, key)
+}
+
+func (s *standby) Replica(since time.Time) RDBMS {
+	return s
+}
+
+func (s *standby) Close() error {
+	return s.primary.Close()
+}
+
+// unavailable reports whether the error is caused by the server rather than the query, like
+// broken connections, shutdowns and the queries canceled by conflicts with the recovery.
+func unavailable(err error) bool {
+	if err == nil {
+		return false
+	} else if errors.Is(err, driver.ErrBadConn) || errors.Is(err, ErrSerialization) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03": // admin shutdown, crash shutdown and cannot connect now
+			return true
+		}
+		return pqErr.Code.Class() == "08" // connection exception
+	}
+
+	return false
+}
+
+// lsn runs the query which returns a WAL position like 16/B374D848 and parses it
+func lsn(ctx context.Context, db *sql.DB, query string) (uint64, error) {
+	var text string
+	if err := db.QueryRowContext(ctx, query).Scan(&text); err != nil {
+		return 0, err
+	}
+
+	high, low, ok := strings.Cut(text, "/")
+	if !ok {
+		return 0, fmt.Errorf("Error invalid WAL position: %s", text)
+	}
+
+	h, err := strconv.ParseUint(high, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Error invalid WAL position: %s", text)
+	}
+
+	l, err := strconv.ParseUint(low, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Error invalid WAL position: %s", text)
+	}
+
+	return h<<32 | l, nil
+}
@@ -0,0 +1,97 @@
+package rdbms
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// Collect runs the query and returns exactly one value per produced row,
+// every value is filled by the scan function from its row.
+func Collect[T any](ctx context.Context, db RDBMS, query string, in []any, scan func(row Row, value *T) error) ([]T, error) {
+	values := []T{}
+	err := db.Query(ctx, query, in, func(row Row) error {
+		var value T
+		if err := scan(row, &value); err != nil {
+			return err
+		}
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// CollectStructs runs the query and scans every produced row into a struct, see ScanStruct.
+func CollectStructs[T any](ctx context.Context, db RDBMS, query string, in []any) ([]T, error) {
+	return Collect(ctx, db, query, in, ScanStruct[T])
+}
+
+// ScanStruct scans the row into the struct by matching the column names with the `db` tags
+// of its fields, slices (other than []byte) are scanned as postgres arrays.
+// All the columns must have a matching field, fields without a column are left untouched.
+func ScanStruct[T any](row Row, value *T) error {
+	columns, err := row.Columns()
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(value).Elem()
+	if target.Kind() != reflect.Struct {
+		return fmt.Errorf("Error scanning into %s, a struct is expected", target.Type())
+	}
+
+	fields := structFields(target.Type())
+	dest := make([]any, len(columns))
+	for index, column := range columns {
+		field, ok := fields[column]
+		if !ok {
+			return fmt.Errorf("Error no field of %s matches the column %s", target.Type(), column)
+		}
+
+		pointer := target.FieldByIndex(field).Addr().Interface()
+		if kind := target.FieldByIndex(field).Kind(); kind == reflect.Slice {
+			if _, isScanner := pointer.(sql.Scanner); !isScanner {
+				if _, isBytes := pointer.(*[]byte); !isBytes {
+					pointer = pq.Array(pointer)
+				}
+			}
+		}
+		dest[index] = pointer
+	}
+
+	return row.Scan(dest...)
+}
+
+// fieldsCache holds the column name to field index mapping of every scanned struct type
+var fieldsCache sync.Map
+
+func structFields(t reflect.Type) map[string][]int {
+	if cached, ok := fieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(t) {
+		tag, ok := field.Tag.Lookup("db")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Index
+	}
+
+	fieldsCache.Store(t, fields)
+	return fields
+}
@@ -0,0 +1,157 @@
+package rdbms
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// statements is a LRU cache of prepared statements keyed by the query text,
+// a statement of *sql.DB is re-prepared transparently on every connection of the pool.
+type statements struct {
+	size  int
+	mutex sync.Mutex
+	items map[string]*list.Element
+	order *list.List // most recently used at the front
+}
+
+// statement is closed once it's removed from the cache and its last user has released it,
+// closing it right away would fail the users which have just taken it.
+type statement struct {
+	query   string
+	stmt    *sql.Stmt
+	users   int
+	removed bool
+}
+
+type uncachedKey struct{}
+
+// Uncached keeps the statements run by the context out of the cache, like the dynamic ones
+// which are hardly ever run again and would only evict the others.
+func Uncached(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uncachedKey{}, true)
+}
+
+func newStatements(size int) *statements {
+	return &statements{size: size, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns the cached statement of the query or prepares a new one,
+// the release function has to be called once the statement is not used anymore.
+func (s *statements) get(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, func(), error) {
+	if uncached, _ := ctx.Value(uncachedKey{}).(bool); s.size <= 0 || uncached {
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stmt, func() { stmt.Close() }, nil
+	}
+
+	s.mutex.Lock()
+	if element, ok := s.items[query]; ok {
+		defer s.mutex.Unlock()
+		return s.use(element)
+	}
+	s.mutex.Unlock()
+
+	// prepare outside of the lock, a round trip shouldn't block the other queries
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// another goroutine may have prepared the same query meanwhile
+	if element, ok := s.items[query]; ok {
+		stmt.Close()
+		return s.use(element)
+	}
+
+	element := s.order.PushFront(&statement{query: query, stmt: stmt})
+	s.items[query] = element
+	for s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+
+	return s.use(element)
+}
+
+// use must be called while holding the lock, it takes the statement until it's released
+func (s *statements) use(element *list.Element) (*sql.Stmt, func(), error) {
+	item := element.Value.(*statement)
+	if !item.removed {
+		s.order.MoveToFront(element)
+	}
+	item.users++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			item.users--
+			if item.removed && item.users == 0 {
+				item.stmt.Close()
+			}
+		})
+	}
+	return item.stmt, release, nil
+}
+
+// invalidate drops the statement of the query, the next use prepares it again
+func (s *statements) invalidate(query string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, ok := s.items[query]; ok {
+		s.remove(element)
+	}
+}
+
+// remove must be called while holding the lock, the statement is closed
+// once its in-flight users have released it.
+func (s *statements) remove(element *list.Element) {
+	item := s.order.Remove(element).(*statement)
+	delete(s.items, item.query)
+
+	item.removed = true
+	if item.users == 0 {
+		item.stmt.Close()
+	}
+}
+
+// stale reports whether the error means the prepared statement can't be used anymore,
+// like broken connections or statements which are invalidated by a schema change.
+func stale(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection exception
+			return true
+		case pqErr.Code == "26000": // invalid sql statement name
+			return true
+		case pqErr.Code == "0A000" && pqErr.Message == "cached plan must not change result type":
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package rdbms
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                 sql.LevelDefault,
+	"read_committed":   sql.LevelReadCommitted,
+	"repeatable_read":  sql.LevelRepeatableRead,
+	"serializable":     sql.LevelSerializable,
+	"read_uncommitted": sql.LevelReadUncommitted,
+}
+
+func (db *rdbms) WithTx(ctx context.Context, fn func(tx RDBMS) error) error {
+	opts := &TxOptions{Isolation: isolationLevels[db.config.Transaction.Isolation]}
+	return db.WithTxOptions(ctx, opts, fn)
+}
+
+func (db *rdbms) WithTxOptions(ctx context.Context, opts *TxOptions, fn func(tx RDBMS) error) error {
+	if db.tx != nil {
+		return db.savepoint(ctx, fn)
+	}
+
+	backoff := db.config.Transaction.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := db.transaction(ctx, opts, fn)
+		if err == nil || attempt >= db.config.Transaction.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		// wait with a jitter, so the conflicting transactions don't collide again
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w\n%v", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+func (db *rdbms) transaction(ctx context.Context, opts *TxOptions, fn func(tx RDBMS) error) error {
+	ctx, cancel := withTimeout(ctx, db.config.Timeout.Transaction)
+	defer cancel()
+
+	tx, err := db.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("%s\n%w", "Error beginning the transaction", err)
+	}
+
+	if err := fn(&rdbms{config: db.config, db: db.db, tx: tx, statements: db.statements}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w\nError rolling back the transaction: %v", err, rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s\n%w", "Error committing the transaction", classify(err))
+	}
+
+	return nil
+}
+
+// savepoint runs a nested transaction, only its own changes are rolled back on failure
+func (db *rdbms) savepoint(ctx context.Context, fn func(tx RDBMS) error) error {
+	nested := &rdbms{config: db.config, db: db.db, tx: db.tx, depth: db.depth + 1, statements: db.statements}
+	name := fmt.Sprintf("savepoint_%d", nested.depth)
+
+	if _, err := db.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("%s\n%w", "Error creating the savepoint", err)
+	}
+
+	if err := fn(nested); err != nil {
+		if _, rollbackErr := db.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); rollbackErr != nil {
+			return fmt.Errorf("%w\nError rolling back to the savepoint: %v", err, rollbackErr)
+		}
+		return err
+	}
+
+	if _, err := db.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+		return fmt.Errorf("%s\n%w", "Error releasing the savepoint", err)
+	}
+
+	return nil
+}
+
+// retryable reports whether the transaction may succeed by running it again,
+// the errors are classified by the statements unless they've been wrapped with %v.
+func retryable(err error) bool {
+	if errors.Is(err, ErrSerialization) || errors.Is(err, ErrDeadlock) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == codeSerializationFailure || pqErr.Code == codeDeadlockDetected
+}
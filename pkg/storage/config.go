@@ -0,0 +1,20 @@
+package storage
+
+type Config struct {
+	Driver     string            `koanf:"driver"`
+	Filesystem *FilesystemConfig `koanf:"filesystem"`
+	S3         *S3Config         `koanf:"s3"`
+}
+
+type FilesystemConfig struct {
+	Root string `koanf:"root"`
+}
+
+type S3Config struct {
+	Endpoint  string `koanf:"endpoint"`
+	Region    string `koanf:"region"`
+	Bucket    string `koanf:"bucket"`
+	AccessKey string `koanf:"access_key"`
+	SecretKey string `koanf:"secret_key"`
+	PathStyle bool   `koanf:"path_style"`
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the content type is kept next to the object in a file with this suffix
+const contentTypeSuffix = ".content-type"
+
+type filesystem struct {
+	root string
+}
+
+func NewFilesystem(cfg *FilesystemConfig) (Storage, error) {
+	if err := os.MkdirAll(cfg.Root, 0o755); err != nil {
+		return nil, fmt.Errorf("Error creating storage root directory:\n%v", err)
+	}
+
+	return &filesystem{root: cfg.Root}, nil
+}
+
+func (f *filesystem) path(key string) (string, error) {
+	path := filepath.Join(f.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(f.root)+string(filepath.Separator)) {
+		return "", fmt.Errorf("Error invalid storage key: %s", key)
+	}
+	return path, nil
+}
+
+func (f *filesystem) Put(key string, data []byte, contentType string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Error creating object directory:\n%v", err)
+	}
+
+	// write into a temporary file and rename it, so readers never see a partial object
+	temp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("Error creating temporary object:\n%v", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("Error writing object:\n%v", err)
+	}
+
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("Error writing object:\n%v", err)
+	}
+
+	if err := os.WriteFile(path+contentTypeSuffix, []byte(contentType), 0o644); err != nil {
+		return fmt.Errorf("Error writing object content type:\n%v", err)
+	}
+
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("Error moving object into place:\n%v", err)
+	}
+
+	return nil
+}
+
+func (f *filesystem) Get(key string) ([]byte, string, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", ErrNotFound
+	} else if err != nil {
+		return nil, "", fmt.Errorf("Error reading object:\n%v", err)
+	}
+
+	contentType, err := os.ReadFile(path + contentTypeSuffix)
+	if err != nil {
+		contentType = []byte("application/octet-stream")
+	}
+
+	return data, string(contentType), nil
+}
+
+func (f *filesystem) Delete(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []string{path, path + contentTypeSuffix} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("Error deleting object:\n%v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilesystemRoundTrip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "storage")
+	storage, err := NewFilesystem(&FilesystemConfig{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "photos/1/2/original.jpg"
+	if _, _, err := storage.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing object has returned %v instead of %v", err, ErrNotFound)
+	}
+
+	if err := storage.Put(key, []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	} else if err := storage.Put(key, []byte("png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, contentType, err := storage.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "png" || contentType != "image/png" {
+		t.Fatalf("object is %q of %q", data, contentType)
+	}
+
+	// the temporary files of the uploads are never left behind
+	entries, err := os.ReadDir(filepath.Join(root, "photos", "1", "2"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 {
+		t.Fatalf("object directory has %d files instead of the object and its content type", len(entries))
+	}
+
+	if err := storage.Delete(key); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := storage.Get(key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted object has returned %v instead of %v", err, ErrNotFound)
+	} else if err := storage.Delete(key); err != nil {
+		t.Fatalf("deleting missing object has failed: %v", err)
+	}
+}
+
+func TestFilesystemKeyOutsideRoot(t *testing.T) {
+	storage, err := NewFilesystem(&FilesystemConfig{Root: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../escaped", "photos/../../escaped", ""} {
+		if err := storage.Put(key, []byte("data"), "text/plain"); err == nil {
+			t.Fatalf("key %q outside of the root has been accepted", key)
+		}
+	}
+}
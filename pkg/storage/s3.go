@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3 talks to any S3-compatible object storage (AWS, MinIO, Ceph, ...)
+// using the plain REST API signed with AWS signature version 4.
+type s3 struct {
+	config   *S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3(cfg *S3Config) (Storage, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || len(endpoint.Host) == 0 {
+		return nil, fmt.Errorf("Error invalid s3 endpoint: %s", cfg.Endpoint)
+	}
+
+	if len(cfg.Bucket) == 0 {
+		return nil, fmt.Errorf("Error missing s3 bucket name")
+	}
+
+	return &s3{config: cfg, endpoint: endpoint, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (s *s3) Put(key string, data []byte, contentType string) error {
+	response, err := s.do(http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return s.failure(response)
+	}
+	return nil
+}
+
+func (s *s3) Get(key string) ([]byte, string, error) {
+	response, err := s.do(http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	} else if response.StatusCode != http.StatusOK {
+		return nil, "", s.failure(response)
+	}
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error reading s3 object:\n%v", err)
+	}
+
+	return data, response.Header.Get("Content-Type"), nil
+}
+
+func (s *s3) Delete(key string) error {
+	response, err := s.do(http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return s.failure(response)
+	}
+	return nil
+}
+
+func (s *s3) failure(response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("Error unexpected s3 response status %d:\n%s", response.StatusCode, body)
+}
+
+func (s *s3) do(method, key string, body []byte, contentType string) (*http.Response, error) {
+	target := *s.endpoint
+	if s.config.PathStyle {
+		target.Path = "/" + s.config.Bucket + "/" + key
+	} else {
+		target.Host = s.config.Bucket + "." + target.Host
+		target.Path = "/" + key
+	}
+	target.RawPath = encodePath(target.Path)
+
+	request, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating s3 request:\n%v", err)
+	}
+
+	if len(contentType) != 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	s.sign(request, body, time.Now().UTC())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("Error sending s3 request:\n%v", err)
+	}
+
+	return response, nil
+}
+
+// sign adds the AWS signature version 4 headers to the request, procedure is as follow:
+//
+// 1. build the canonical request out of method, path, query, headers and payload hash
+//
+// 2. build the string to sign out of the date, credential scope and canonical request hash
+//
+// 3. derive the signing key from the secret and sign the string
+func (s *s3) sign(request *http.Request, body []byte, now time.Time) {
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if len(request.Header.Get("Content-Type")) != 0 {
+		signedHeaders = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	}
+
+	canonicalHeaders := ""
+	for _, header := range signedHeaders {
+		canonicalHeaders += header + ":" + strings.TrimSpace(request.Header.Get(header)) + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+// encodePath escapes every byte of the path except the unreserved ones and slashes
+func encodePath(path string) string {
+	var builder strings.Builder
+	for _, b := range []byte(path) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
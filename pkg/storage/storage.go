@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotFound = errors.New("Error no object found with given key")
+
+// Storage keeps binary objects (like photos) addressed by slash separated keys
+type Storage interface {
+	Put(key string, data []byte, contentType string) error
+
+	Get(key string) (data []byte, contentType string, err error)
+
+	Delete(key string) error
+}
+
+const (
+	DriverFilesystem = "filesystem"
+	DriverS3         = "s3"
+)
+
+func New(cfg *Config) (Storage, error) {
+	switch cfg.Driver {
+	case DriverFilesystem:
+		return NewFilesystem(cfg.Filesystem)
+	case DriverS3:
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("Error unknown storage driver: %s", cfg.Driver)
+	}
+}
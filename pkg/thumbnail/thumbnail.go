@@ -0,0 +1,111 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("Error unsupported image format")
+	ErrTooLarge          = errors.New("Error image dimensions are too large")
+)
+
+// MaxPixels protects against decompression bombs, small files which decode into huge images
+const MaxPixels = 40_000_000
+
+type Size string
+
+const (
+	Original Size = "original" // the uploaded image itself
+
+	Small  Size = "small"
+	Medium Size = "medium"
+	Large  Size = "large"
+)
+
+// Sizes are the standard square dimensions of the generated thumbnails
+var Sizes = map[Size]int{
+	Small:  64,
+	Medium: 256,
+	Large:  512,
+}
+
+// supported content types, detected by sniffing the data (not trusting the client)
+var contentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// DetectContentType sniffs the content type of the data
+// and fails if it's not one of the supported image formats.
+func DetectContentType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !contentTypes[contentType] {
+		return "", ErrUnsupportedFormat
+	}
+	return contentType, nil
+}
+
+// Generate creates a JPEG thumbnail for each of the standard sizes,
+// the image is center-cropped to a square and then scaled down.
+func Generate(data []byte) (map[Size][]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	} else if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	bounds := source.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x, y, x+side, y+side)
+
+	result := make(map[Size][]byte, len(Sizes))
+	for size, dimension := range Sizes {
+		// never scale images up
+		if side < dimension {
+			dimension = side
+		}
+
+		target := image.NewRGBA(image.Rect(0, 0, dimension, dimension))
+		draw.CatmullRom.Scale(target, target.Bounds(), source, crop, draw.Src, nil)
+
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, target, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		result[size] = buffer.Bytes()
+	}
+
+	return result, nil
+}
+
+// Keys returns the storage keys of the original image and all of its thumbnails
+func Keys(prefix string) []string {
+	keys := []string{prefix + "/" + string(Original)}
+	for size := range Sizes {
+		keys = append(keys, prefix+"/"+string(size))
+	}
+	return keys
+}
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"context"
 	"crypto"
 	"encoding/json"
 	"errors"
@@ -11,8 +12,8 @@ import (
 )
 
 type Token interface {
-	CreateTokenString(data any) (string, error)
-	ExtractTokenData(tokenString string, data any) error
+	CreateTokenString(ctx context.Context, data any) (string, error)
+	ExtractTokenData(ctx context.Context, tokenString string, data any) error
 }
 
 type token struct {
@@ -47,7 +48,11 @@ type Payload struct {
 	jwt.RegisteredClaims
 }
 
-func (token *token) CreateTokenString(data any) (string, error) {
+func (token *token) CreateTokenString(ctx context.Context, data any) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
 		errStr := fmt.Sprintf("error marshal data: %v", err)
@@ -68,7 +73,11 @@ const (
 	errorUnmarshalData  = "error unmarshaling the data"
 )
 
-func (token *token) ExtractTokenData(tokenString string, data any) error {
+func (token *token) ExtractTokenData(ctx context.Context, tokenString string, data any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	checkSigningMethod := func(jwtToken *jwt.Token) (any, error) {
 		if _, ok := jwtToken.Method.(*jwt.SigningMethodEd25519); !ok {
 			return nil, fmt.Errorf("wrong signing method: %v", jwtToken.Header["alg"])
@@ -0,0 +1,196 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldError tells why a field is invalid, the field is named by its json name
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors are all of the invalid fields of a struct
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Field+" "+err.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// rule checks the value against the parameter of the rule, an empty message means it's valid
+type rule func(value reflect.Value, param string) string
+
+// patterns are the regular expressions of the rules matching the strings against one
+var patterns = map[string]*regexp.Regexp{
+	"phone": regexp.MustCompile(`^\+?[0-9 ().-]*[0-9][0-9 ().-]*$`),
+	"color": regexp.MustCompile(`^#[0-9a-fA-F]{6}$`),
+}
+
+var rules = map[string]rule{
+	"required": required,
+	"min":      minimum,
+	"max":      maximum,
+	"email":    email,
+	"phone":    pattern(patterns["phone"], "must be a phone number"),
+	"color":    pattern(patterns["color"], "must be a hex color like #1a2b3c"),
+	"password": password,
+}
+
+// Pattern returns the regular expression of the rule, if it's one of the pattern rules
+func Pattern(rule string) (string, bool) {
+	regex, ok := patterns[rule]
+	if !ok {
+		return "", false
+	}
+	return regex.String(), true
+}
+
+// Struct validates the fields of the struct by the comma separated rules of their validate tags:
+//
+//	required   the field must not be empty (or zero)
+//	min=N      strings must have at least N characters, slices at least N items
+//	max=N      strings must have at most N characters, slices at most N items
+//	email      the string must be an email address
+//	phone      the string must have a digit, and only digits, spaces, dots, dashes, parentheses and a leading plus
+//	color      the string must be a hex color
+//	password   the string must have letters and digits both
+//	dive       the rules after it are applied to every item of the slice
+//
+// All of the fields are checked and only the first failing rule of each one is reported, the
+// rules other than required and min accept the empty values.
+func Struct(value any) error {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T is not a struct", value))
+	}
+
+	var errs Errors
+	for index := 0; index < v.NumField(); index++ {
+		field := v.Type().Field(index)
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		errs = check(errs, name(field), v.Field(index), strings.Split(tag, ","))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func check(errs Errors, field string, value reflect.Value, tags []string) Errors {
+	for index, tag := range tags {
+		if tag == "dive" {
+			for item := 0; item < value.Len(); item++ {
+				errs = check(errs, fmt.Sprintf("%s[%d]", field, item), value.Index(item), tags[index+1:])
+			}
+			return errs
+		}
+
+		name, param, _ := strings.Cut(tag, "=")
+		rule, ok := rules[name]
+		if !ok {
+			panic(fmt.Sprintf("validate: unknown rule %s of field %s", name, field))
+		}
+
+		if message := rule(value, param); len(message) != 0 {
+			return append(errs, FieldError{Field: field, Rule: name, Message: message})
+		}
+	}
+	return errs
+}
+
+// name returns the json name of the field, as the clients know it
+func name(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); len(name) != 0 && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// length returns the characters of strings and the items of the other values along with their unit
+func length(value reflect.Value) (int, string) {
+	if value.Kind() == reflect.String {
+		return utf8.RuneCountInString(value.String()), "characters"
+	}
+	return value.Len(), "items"
+}
+
+func required(value reflect.Value, _ string) string {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if value.Len() != 0 {
+			return ""
+		}
+	default:
+		if !value.IsZero() {
+			return ""
+		}
+	}
+	return "is required"
+}
+
+func minimum(value reflect.Value, param string) string {
+	limit, _ := strconv.Atoi(param)
+	if count, unit := length(value); count < limit {
+		return fmt.Sprintf("must have at least %d %s", limit, unit)
+	}
+	return ""
+}
+
+func maximum(value reflect.Value, param string) string {
+	limit, _ := strconv.Atoi(param)
+	if count, unit := length(value); count > limit {
+		return fmt.Sprintf("must have at most %d %s", limit, unit)
+	}
+	return ""
+}
+
+func email(value reflect.Value, _ string) string {
+	if len(value.String()) == 0 {
+		return ""
+	}
+
+	// the address must be bare, so the display names like "Name <name@example.com>" aren't accepted
+	address, err := mail.ParseAddress(value.String())
+	if err != nil || address.Address != value.String() {
+		return "must be an email address"
+	}
+	return ""
+}
+
+func pattern(regex *regexp.Regexp, message string) rule {
+	return func(value reflect.Value, _ string) string {
+		if len(value.String()) != 0 && !regex.MatchString(value.String()) {
+			return message
+		}
+		return ""
+	}
+}
+
+func password(value reflect.Value, _ string) string {
+	letter, digit := false, false
+	for _, r := range value.String() {
+		letter = letter || unicode.IsLetter(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+
+	if len(value.String()) != 0 && (!letter || !digit) {
+		return "must have letters and digits both"
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type rulesStruct struct {
+	Required string   `json:"required" validate:"required"`
+	Count    int      `json:"count" validate:"required"`
+	Min      string   `json:"min" validate:"min=3"`
+	Max      string   `json:"max" validate:"max=3"`
+	Items    []string `json:"items" validate:"min=1,max=2"`
+	Email    string   `json:"email" validate:"email"`
+	Phone    string   `json:"phone" validate:"phone"`
+	Color    string   `json:"color" validate:"color"`
+	Password string   `json:"password" validate:"password"`
+}
+
+func valid() rulesStruct {
+	return rulesStruct{
+		Required: "value", Count: 1, Min: "abc", Max: "abc", Items: []string{"a"},
+		Email: "name@example.com", Phone: "+1 (555) 010-0.1", Color: "#1a2B3c", Password: "secret1",
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(value *rulesStruct)
+		field  string // the only invalid field, none if empty
+		rule   string
+	}{
+		{"valid", func(value *rulesStruct) {}, "", ""},
+		{"required string", func(value *rulesStruct) { value.Required = "" }, "required", "required"},
+		{"required number", func(value *rulesStruct) { value.Count = 0 }, "count", "required"},
+		{"min string", func(value *rulesStruct) { value.Min = "ab" }, "min", "min"},
+		{"min counts characters", func(value *rulesStruct) { value.Min = "héé" }, "", ""},
+		{"min of empty string", func(value *rulesStruct) { value.Min = "" }, "min", "min"},
+		{"max string", func(value *rulesStruct) { value.Max = "abcd" }, "max", "max"},
+		{"max counts characters", func(value *rulesStruct) { value.Max = "ééé" }, "", ""},
+		{"min items", func(value *rulesStruct) { value.Items = nil }, "items", "min"},
+		{"max items", func(value *rulesStruct) { value.Items = []string{"a", "b", "c"} }, "items", "max"},
+		{"email", func(value *rulesStruct) { value.Email = "name@" }, "email", "email"},
+		{"email with display name", func(value *rulesStruct) { value.Email = "Name <name@example.com>" }, "email", "email"},
+		{"empty email", func(value *rulesStruct) { value.Email = "" }, "", ""},
+		{"phone with letters", func(value *rulesStruct) { value.Phone = "+1555abc" }, "phone", "phone"},
+		{"phone with inner plus", func(value *rulesStruct) { value.Phone = "1+555" }, "phone", "phone"},
+		{"phone of parentheses", func(value *rulesStruct) { value.Phone = "()" }, "phone", "phone"},
+		{"phone of dots", func(value *rulesStruct) { value.Phone = "..." }, "phone", "phone"},
+		{"phone of dashes", func(value *rulesStruct) { value.Phone = "- -" }, "phone", "phone"},
+		{"phone of plus", func(value *rulesStruct) { value.Phone = "+" }, "phone", "phone"},
+		{"phone of a digit", func(value *rulesStruct) { value.Phone = "5" }, "", ""},
+		{"empty phone", func(value *rulesStruct) { value.Phone = "" }, "", ""},
+		{"color without hash", func(value *rulesStruct) { value.Color = "1a2b3c" }, "color", "color"},
+		{"short color", func(value *rulesStruct) { value.Color = "#fff" }, "color", "color"},
+		{"color with non hex digit", func(value *rulesStruct) { value.Color = "#1a2b3g" }, "color", "color"},
+		{"password of letters", func(value *rulesStruct) { value.Password = "secret" }, "password", "password"},
+		{"password of digits", func(value *rulesStruct) { value.Password = "123456" }, "password", "password"},
+		{"empty password", func(value *rulesStruct) { value.Password = "" }, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := valid()
+			test.change(&value)
+
+			err := Struct(&value)
+			if len(test.field) == 0 {
+				if err != nil {
+					t.Fatalf("valid struct has returned %v", err)
+				}
+				return
+			}
+
+			var errs Errors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("struct has returned %v instead of a single invalid field", err)
+			} else if errs[0].Field != test.field || errs[0].Rule != test.rule || len(errs[0].Message) == 0 {
+				t.Fatalf("struct has returned %+v instead of the %s rule of %s", errs[0], test.rule, test.field)
+			}
+		})
+	}
+}
+
+type diveStruct struct {
+	Phones []string `json:"phones" validate:"required,max=3,dive,required,phone"`
+	Named  string   `validate:"required"`
+	Hidden string   `json:"-" validate:"required"`
+	Free   string   `json:"free"`
+}
+
+func TestDive(t *testing.T) {
+	value := diveStruct{Phones: []string{"+15550100", "", "phone", "5550101"}, Named: "x", Hidden: "x"}
+
+	// the items aren't checked once a rule before dive has failed
+	var errs Errors
+	if err := Struct(value); !errors.As(err, &errs) {
+		t.Fatalf("struct has returned %v", err)
+	} else if want := (Errors{{Field: "phones", Rule: "max", Message: "must have at most 3 items"}}); !reflect.DeepEqual(errs, want) {
+		t.Fatalf("struct has returned %+v instead of %+v", errs, want)
+	}
+
+	value.Phones = value.Phones[:3]
+	want := Errors{
+		{Field: "phones[1]", Rule: "required", Message: "is required"},
+		{Field: "phones[2]", Rule: "phone", Message: "must be a phone number"},
+	}
+	if err := Struct(value); !errors.As(err, &errs) {
+		t.Fatalf("struct has returned %v", err)
+	} else if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("struct has returned %+v instead of %+v", errs, want)
+	} else if errs.Error() != "phones[1] is required, phones[2] must be a phone number" {
+		t.Fatalf("errors are described as %q", errs.Error())
+	}
+}
+
+func TestFieldNames(t *testing.T) {
+	var errs Errors
+	if err := Struct(diveStruct{}); !errors.As(err, &errs) {
+		t.Fatalf("struct has returned %v", err)
+	}
+
+	// the fields without a json name keep their go name
+	fields := []string{}
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	if want := []string{"phones", "Named", "Hidden"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("invalid fields are %v instead of %v", fields, want)
+	}
+}
+
+// TestFirstFailure checks only the first failing rule of a field is reported
+func TestFirstFailure(t *testing.T) {
+	value := struct {
+		Email string `json:"email" validate:"required,min=5,email"`
+		Name  string `json:"name" validate:"min=2,max=4"`
+	}{Email: "a@b", Name: "a"}
+
+	want := Errors{
+		{Field: "email", Rule: "min", Message: "must have at least 5 characters"},
+		{Field: "name", Rule: "min", Message: "must have at least 2 characters"},
+	}
+
+	var errs Errors
+	if err := Struct(&value); !errors.As(err, &errs) {
+		t.Fatalf("struct has returned %v", err)
+	} else if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("struct has returned %+v instead of %+v", errs, want)
+	}
+}
+
+func TestInvalidUsage(t *testing.T) {
+	for name, value := range map[string]any{
+		"not a struct": "value",
+		"unknown rule": struct {
+			Name string `validate:"unknown"`
+		}{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("invalid usage hasn't panicked")
+				}
+			}()
+			Struct(value)
+		})
+	}
+}